@@ -0,0 +1,232 @@
+package transport_api_client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// AdaptiveLimiterSettings configures an AdaptiveLimiter.
+// Zero fields are replaced with the default values.
+type AdaptiveLimiterSettings struct {
+	// InitialRate is the starting rate in requests per second. Default is 10.
+	InitialRate float64
+	// MinRate is the lowest rate the limiter can decrease to. Default is 1.
+	MinRate float64
+	// MaxRate is the highest rate the limiter can increase to. Default is 100.
+	MaxRate float64
+	// Burst is the maximum burst size. Default is 1.
+	Burst int
+	// DecreaseFactor multiplies the rate on throttling. Default is 0.5.
+	DecreaseFactor float64
+	// IncreaseStep is added to the rate after IncreaseInterval without throttling. Default is 1.
+	IncreaseStep float64
+	// IncreaseInterval is the minimal time after a rate change before the next increase,
+	// and between two decreases. Default is 1s.
+	IncreaseInterval time.Duration
+}
+
+func (s AdaptiveLimiterSettings) withDefaults() AdaptiveLimiterSettings {
+	if s.MinRate <= 0 {
+		s.MinRate = 1
+	}
+	if s.MaxRate <= 0 {
+		s.MaxRate = 100
+	}
+	if s.InitialRate <= 0 {
+		s.InitialRate = 10
+	}
+	s.InitialRate = min(max(s.InitialRate, s.MinRate), s.MaxRate)
+	if s.Burst <= 0 {
+		s.Burst = 1
+	}
+	if s.DecreaseFactor <= 0 || s.DecreaseFactor >= 1 {
+		s.DecreaseFactor = 0.5
+	}
+	if s.IncreaseStep <= 0 {
+		s.IncreaseStep = 1
+	}
+	if s.IncreaseInterval <= 0 {
+		s.IncreaseInterval = time.Second
+	}
+
+	return s
+}
+
+// AdaptiveLimiter is a RateLimiter that adjusts its rate using AIMD (additive increase,
+// multiplicative decrease): the rate is cut on throttling and slowly recovers afterwards.
+// Use it with the Limiter middleware and feed it responses with the RateLimitFeedback middleware.
+type AdaptiveLimiter struct {
+	settings AdaptiveLimiterSettings
+	limiter  *rate.Limiter
+
+	mu           sync.Mutex
+	rate         float64
+	lastChange   time.Time
+	lastDecrease time.Time
+	pausedUntil  time.Time
+}
+
+// NewAdaptiveLimiter creates a new AdaptiveLimiter.
+func NewAdaptiveLimiter(s AdaptiveLimiterSettings) *AdaptiveLimiter {
+	s = s.withDefaults()
+
+	return &AdaptiveLimiter{
+		settings:   s,
+		limiter:    rate.NewLimiter(rate.Limit(s.InitialRate), s.Burst),
+		rate:       s.InitialRate,
+		lastChange: time.Now(),
+	}
+}
+
+// Wait blocks until the request is allowed by the current rate and any pause
+// requested by the server has passed.
+func (l *AdaptiveLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return l.limiter.Wait(ctx)
+}
+
+// Rate returns the current rate in requests per second.
+func (l *AdaptiveLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// Throttled decreases the rate multiplicatively. If pause is positive,
+// no requests are allowed until it passes.
+func (l *AdaptiveLimiter) Throttled(pause time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if pause > 0 {
+		l.pauseUntil(now.Add(pause))
+	}
+
+	// concurrent requests are usually throttled together, so the rate is cut once per interval
+	if now.Sub(l.lastDecrease) < l.settings.IncreaseInterval {
+		return
+	}
+
+	l.lastDecrease = now
+	l.setRate(now, max(l.rate*l.settings.DecreaseFactor, l.settings.MinRate))
+}
+
+// Succeeded increases the rate additively if IncreaseInterval has passed since the last change.
+func (l *AdaptiveLimiter) Succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.rate >= l.settings.MaxRate || now.Sub(l.lastChange) < l.settings.IncreaseInterval {
+		return
+	}
+
+	l.setRate(now, min(l.rate+l.settings.IncreaseStep, l.settings.MaxRate))
+}
+
+// PauseUntil disallows requests until t, e.g. until the rate limit window is reset.
+func (l *AdaptiveLimiter) PauseUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pauseUntil(t)
+}
+
+func (l *AdaptiveLimiter) pauseUntil(t time.Time) {
+	if t.After(l.pausedUntil) {
+		l.pausedUntil = t
+	}
+}
+
+func (l *AdaptiveLimiter) setRate(now time.Time, r float64) {
+	l.rate = r
+	l.lastChange = now
+	l.limiter.SetLimitAt(now, rate.Limit(r))
+}
+
+// RateLimitFeedback is a middleware that reports responses to the AdaptiveLimiter.
+// A 429 response decreases the rate, other responses let it recover.
+// Retry-After on 429 and 503 responses, and exhausted X-RateLimit-Remaining (or RateLimit-Remaining)
+// with the corresponding Reset header pause the limiter.
+func RateLimitFeedback(l *AdaptiveLimiter) Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			if err != nil {
+				return resp, err
+			}
+
+			retryAfter, hasRetryAfter := parseRetryAfter(resp)
+
+			switch {
+			case resp.StatusCode == http.StatusTooManyRequests:
+				l.Throttled(retryAfter)
+			case hasRetryAfter:
+				l.PauseUntil(time.Now().Add(retryAfter))
+			case resp.StatusCode < http.StatusInternalServerError:
+				l.Succeeded()
+			}
+
+			if reset, ok := rateLimitReset(resp.Header); ok {
+				l.PauseUntil(time.Now().Add(reset))
+			}
+
+			return resp, err
+		})
+	}
+}
+
+// rateLimitReset returns the time until the rate limit window is reset,
+// if the rate limit headers report that no requests remain.
+func rateLimitReset(h http.Header) (time.Duration, bool) {
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		remaining := h.Get(prefix + "Remaining")
+		if remaining == "" {
+			continue
+		}
+
+		if n, err := strconv.Atoi(remaining); err != nil || n > 0 {
+			return 0, false
+		}
+
+		return rateLimitResetDelay(h.Get(prefix + "Reset"))
+	}
+
+	return 0, false
+}
+
+// rateLimitResetDelay parses the Reset header, which is either a number of seconds
+// or a Unix timestamp.
+func rateLimitResetDelay(v string) (time.Duration, bool) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	// values larger than a year are Unix timestamps
+	if n > 365*24*60*60 {
+		return max(time.Until(time.Unix(n, 0)), 0), true
+	}
+
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,151 @@
+package transport_api_client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("satisfies RateLimiter", func(t *testing.T) {
+		t.Parallel()
+
+		var _ RateLimiter = NewAdaptiveLimiter(AdaptiveLimiterSettings{})
+
+		lim := NewAdaptiveLimiter(AdaptiveLimiterSettings{InitialRate: 50, Burst: 2})
+		doer := Limiter(lim)(fakeDoer(200, nil))
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("default settings", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(AdaptiveLimiterSettings{})
+		require.Equal(t, 10.0, lim.Rate())
+	})
+
+	t.Run("rate decreases multiplicatively and recovers additively", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(AdaptiveLimiterSettings{
+			InitialRate:      20,
+			MinRate:          4,
+			MaxRate:          22,
+			IncreaseStep:     5,
+			IncreaseInterval: 10 * time.Millisecond,
+		})
+
+		lim.Throttled(0)
+		require.Equal(t, 10.0, lim.Rate())
+
+		// throttling within the interval is counted once
+		lim.Throttled(0)
+		require.Equal(t, 10.0, lim.Rate())
+
+		time.Sleep(15 * time.Millisecond)
+		lim.Throttled(0)
+		require.Equal(t, 5.0, lim.Rate())
+
+		time.Sleep(15 * time.Millisecond)
+		lim.Throttled(0)
+		require.Equal(t, 4.0, lim.Rate(), "rate must not go below MinRate")
+
+		lim.Succeeded()
+		require.Equal(t, 4.0, lim.Rate(), "rate must not increase right after a change")
+
+		for _, expected := range []float64{9, 14, 19, 22, 22} {
+			time.Sleep(15 * time.Millisecond)
+			lim.Succeeded()
+			require.Equal(t, expected, lim.Rate())
+		}
+	})
+
+	t.Run("pause blocks Wait", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(AdaptiveLimiterSettings{InitialRate: 100})
+		lim.PauseUntil(time.Now().Add(100 * time.Millisecond))
+
+		start := time.Now()
+		require.NoError(t, lim.Wait(context.Background()))
+		require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+		lim.PauseUntil(time.Now().Add(time.Minute))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, lim.Wait(ctx), context.DeadlineExceeded)
+	})
+}
+
+func TestRateLimitFeedbackMiddleware(t *testing.T) {
+	t.Parallel()
+
+	respond := func(status int, header http.Header) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: http.NoBody, Header: header}, nil
+		})
+	}
+
+	t.Run("429 decreases the rate and pauses on Retry-After", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(AdaptiveLimiterSettings{InitialRate: 10})
+		doer := RateLimitFeedback(lim)(respond(429, http.Header{"Retry-After": []string{"1"}}))
+		req, _ := http.NewRequest("POST", "http://example.com/messages", nil)
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 5.0, lim.Rate())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, lim.Wait(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("exhausted rate limit pauses until reset", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(AdaptiveLimiterSettings{InitialRate: 10})
+		reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+		doer := RateLimitFeedback(lim)(respond(200, http.Header{
+			"X-Ratelimit-Remaining": []string{"0"},
+			"X-Ratelimit-Reset":     []string{reset},
+		}))
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 10.0, lim.Rate())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, lim.Wait(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("remaining requests do not pause", func(t *testing.T) {
+		t.Parallel()
+
+		_, ok := rateLimitReset(http.Header{
+			"Ratelimit-Remaining": []string{"5"},
+			"Ratelimit-Reset":     []string{"10"},
+		})
+		require.False(t, ok)
+
+		d, ok := rateLimitReset(http.Header{
+			"Ratelimit-Remaining": []string{"0"},
+			"Ratelimit-Reset":     []string{"10"},
+		})
+		require.True(t, ok)
+		require.Equal(t, 10*time.Second, d)
+	})
+}
@@ -10,6 +10,7 @@ const (
 )
 
 // WithTransportToken sets a transport token in the HTTP request header for authentication purposes.
+// Use WithTokenProvider to rotate tokens without rebuilding the client.
 func WithTransportToken(token string) ClientOption {
 	return WithRequestEditorFn(func(_ context.Context, req *http.Request) error {
 		req.Header.Set(transportTokenHeader, token)
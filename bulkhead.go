@@ -0,0 +1,202 @@
+package transport_api_client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBulkheadFull is matched by the error returned by the Bulkhead middleware
+// when a request is rejected because of too many in-flight requests.
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// BulkheadFullError is returned by the Bulkhead middleware for rejected requests.
+type BulkheadFullError struct {
+	// Group is the operation group, or "global" for the global limit.
+	Group string
+	// Waited is the time the request spent in the queue.
+	Waited time.Duration
+}
+
+func (e *BulkheadFullError) Error() string {
+	return fmt.Sprintf("%s: %s (waited %v)", ErrBulkheadFull, e.Group, e.Waited)
+}
+
+func (e *BulkheadFullError) Is(target error) bool { return target == ErrBulkheadFull }
+
+// BulkheadEvent describes an attempt to acquire a slot in the Bulkhead middleware.
+type BulkheadEvent struct {
+	// Group is the operation group, or "global" for the global limit.
+	Group string
+	// InFlight is the number of in-flight requests in the group after the attempt.
+	InFlight int
+	// QueueDepth is the number of requests waiting in the group queue after the attempt.
+	QueueDepth int
+	// Waited is the time the request spent in the queue.
+	Waited time.Duration
+	// Rejected is true if the request was rejected.
+	Rejected bool
+}
+
+// BulkheadSettings configures the Bulkhead middleware.
+type BulkheadSettings struct {
+	// MaxConcurrent caps in-flight requests of all operations. Zero means no global limit.
+	MaxConcurrent int
+	// Groups caps in-flight requests per operation group. Groups without a limit are not capped.
+	Groups map[OperationGroup]int
+	// MaxQueue is the number of requests that may wait for a slot in each group.
+	// Zero means requests are rejected as soon as the group is full.
+	MaxQueue int
+	// MaxWait limits the time a request waits in the queue. Zero means waiting until the context is done.
+	MaxWait time.Duration
+	// OnEvent is called on every acquired or rejected slot, e.g. to report queue depth and wait time.
+	OnEvent func(BulkheadEvent)
+}
+
+const bulkheadGlobalGroup = "global"
+
+// Bulkhead is a middleware that caps concurrent requests globally and per operation group,
+// so that e.g. a burst of file uploads does not starve message operations.
+// A request first takes a slot in its group and then in the global limit.
+// Requests that can't get a slot within MaxWait, or don't fit in the queue,
+// fail with *BulkheadFullError. The slot is released when the response body is closed.
+func Bulkhead(s BulkheadSettings) Middleware {
+	var global *compartment
+	if s.MaxConcurrent > 0 {
+		global = newCompartment(bulkheadGlobalGroup, s.MaxConcurrent, &s)
+	}
+
+	groups := make(map[OperationGroup]*compartment, len(s.Groups))
+	for g, limit := range s.Groups {
+		if limit > 0 {
+			groups[g] = newCompartment(string(g), limit, &s)
+		}
+	}
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			var acquired []*compartment
+			release := func() {
+				for _, c := range acquired {
+					c.release()
+				}
+			}
+
+			if op, ok := requestOperation(req); ok {
+				if c, ok := groups[op.Group]; ok {
+					acquired = append(acquired, c)
+				}
+			}
+			if global != nil {
+				acquired = append(acquired, global)
+			}
+
+			for i, c := range acquired {
+				if err := c.acquire(req); err != nil {
+					acquired = acquired[:i]
+					release()
+					return nil, err
+				}
+			}
+
+			resp, err := next.Do(req)
+			if err != nil || resp.Body == nil {
+				release()
+				return resp, err
+			}
+
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+
+			return resp, nil
+		})
+	}
+}
+
+// compartment is a semaphore with a bounded queue.
+type compartment struct {
+	name     string
+	slots    chan struct{}
+	waiting  atomic.Int32
+	settings *BulkheadSettings
+}
+
+func newCompartment(name string, limit int, s *BulkheadSettings) *compartment {
+	return &compartment{
+		name:     name,
+		slots:    make(chan struct{}, limit),
+		settings: s,
+	}
+}
+
+func (c *compartment) acquire(req *http.Request) error {
+	select {
+	case c.slots <- struct{}{}:
+		c.report(0, false)
+		return nil
+	default:
+	}
+
+	if int(c.waiting.Add(1)) > c.settings.MaxQueue {
+		c.waiting.Add(-1)
+		c.report(0, true)
+		return &BulkheadFullError{Group: c.name}
+	}
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if c.settings.MaxWait > 0 {
+		timer := time.NewTimer(c.settings.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		c.waiting.Add(-1)
+		c.report(time.Since(start), false)
+		return nil
+	case <-timeout:
+		c.waiting.Add(-1)
+		c.report(time.Since(start), true)
+		return &BulkheadFullError{Group: c.name, Waited: time.Since(start)}
+	case <-req.Context().Done():
+		c.waiting.Add(-1)
+		c.report(time.Since(start), true)
+		return req.Context().Err()
+	}
+}
+
+func (c *compartment) release() {
+	<-c.slots
+}
+
+func (c *compartment) report(waited time.Duration, rejected bool) {
+	if c.settings.OnEvent == nil {
+		return
+	}
+
+	c.settings.OnEvent(BulkheadEvent{
+		Group:      c.name,
+		InFlight:   len(c.slots),
+		QueueDepth: int(c.waiting.Load()),
+		Waited:     waited,
+		Rejected:   rejected,
+	})
+}
+
+// releaseOnClose calls release once, when the response body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
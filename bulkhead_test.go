@@ -0,0 +1,179 @@
+package transport_api_client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingDoer blocks requests until release is closed.
+func blockingDoer(started chan<- struct{}, release <-chan struct{}) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+}
+
+func TestBulkheadMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("full group rejects requests without blocking other groups", func(t *testing.T) {
+		t.Parallel()
+
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+		doer := Bulkhead(BulkheadSettings{
+			Groups: map[OperationGroup]int{OperationGroupFiles: 1},
+		})(blockingDoer(started, release))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "http://example.com/files/upload", nil)
+			resp, err := doer.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+		}()
+		<-started
+
+		req, _ := http.NewRequest("POST", "http://example.com/files/upload_by_url", nil)
+		_, err := doer.Do(req)
+		require.ErrorIs(t, err, ErrBulkheadFull)
+
+		var fullErr *BulkheadFullError
+		require.ErrorAs(t, err, &fullErr)
+		require.Equal(t, "files", fullErr.Group)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "http://example.com/messages", nil)
+			resp, err := doer.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+		}()
+		<-started
+
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("queued request waits for a slot", func(t *testing.T) {
+		t.Parallel()
+
+		synctest.Test(t, func(t *testing.T) {
+			var (
+				mu     sync.Mutex
+				events []BulkheadEvent
+			)
+
+			started := make(chan struct{}, 10)
+			release := make(chan struct{})
+			doer := Bulkhead(BulkheadSettings{
+				MaxConcurrent: 1,
+				MaxQueue:      1,
+				OnEvent: func(e BulkheadEvent) {
+					mu.Lock()
+					defer mu.Unlock()
+					events = append(events, e)
+				},
+			})(blockingDoer(started, release))
+
+			first, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+			go func() {
+				resp, err := doer.Do(first)
+				require.NoError(t, err)
+				time.Sleep(20 * time.Millisecond)
+				require.NoError(t, resp.Body.Close())
+			}()
+			<-started
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				req, _ := http.NewRequest("GET", "http://example.com/templates", nil)
+				resp, err := doer.Do(req)
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+			}()
+
+			// wait until the second request is queued
+			synctest.Wait()
+
+			// the queue is full
+			req, _ := http.NewRequest("GET", "http://example.com/templates", nil)
+			_, err := doer.Do(req)
+			require.ErrorIs(t, err, ErrBulkheadFull)
+
+			close(release)
+			<-started
+			<-done
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Len(t, events, 3)
+			require.True(t, events[1].Rejected)
+			require.Equal(t, 1, events[1].QueueDepth)
+			require.False(t, events[2].Rejected)
+			require.Equal(t, "global", events[2].Group)
+			require.GreaterOrEqual(t, events[2].Waited, 10*time.Millisecond)
+		})
+	})
+
+	t.Run("max wait rejects queued request", func(t *testing.T) {
+		t.Parallel()
+
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+		defer close(release)
+
+		doer := Bulkhead(BulkheadSettings{
+			Groups:   map[OperationGroup]int{OperationGroupMessages: 1},
+			MaxQueue: 10,
+			MaxWait:  20 * time.Millisecond,
+		})(blockingDoer(started, release))
+
+		go func() {
+			req, _ := http.NewRequest("POST", "http://example.com/messages/ack", nil)
+			_, _ = doer.Do(req)
+		}()
+		<-started
+
+		req, _ := http.NewRequest("POST", "http://example.com/messages/read", nil)
+		_, err := doer.Do(req)
+
+		var fullErr *BulkheadFullError
+		require.ErrorAs(t, err, &fullErr)
+		require.GreaterOrEqual(t, fullErr.Waited, 20*time.Millisecond)
+	})
+
+	t.Run("context cancellation stops waiting", func(t *testing.T) {
+		t.Parallel()
+
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+		defer close(release)
+
+		doer := Bulkhead(BulkheadSettings{MaxConcurrent: 1, MaxQueue: 1})(blockingDoer(started, release))
+
+		go func() {
+			req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+			_, _ = doer.Do(req)
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/channels", nil)
+		_, err := doer.Do(req)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
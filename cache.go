@@ -0,0 +1,228 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CacheEntry is a cached response.
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// ExpiresAt is the time after which the entry must be revalidated.
+	ExpiresAt time.Time
+}
+
+// CacheStore stores cached responses. Expired entries should be kept while possible,
+// as they are used for revalidation with ETag and Last-Modified.
+// Implementations must be safe for concurrent use.
+//
+// Invalidation after mutating calls is tracked by the middleware in memory,
+// so with a store shared between processes it is local to each process.
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+}
+
+type memoryCacheStore struct {
+	entries *lru[string, *CacheEntry]
+}
+
+// NewMemoryCacheStore creates an in-memory CacheStore keeping up to maxEntries
+// least recently used entries.
+func NewMemoryCacheStore(maxEntries int) CacheStore {
+	return &memoryCacheStore{entries: newLRU[string, *CacheEntry](maxEntries)}
+}
+
+func (s *memoryCacheStore) Get(key string) (*CacheEntry, bool) { return s.entries.get(key) }
+
+func (s *memoryCacheStore) Set(key string, entry *CacheEntry) { s.entries.set(key, entry) }
+
+// CacheSettings configures the Cache middleware.
+type CacheSettings struct {
+	// Store keeps cached responses. Default is an in-memory store of 1000 entries.
+	Store CacheStore
+	// TTLs configures how long responses of each operation are fresh.
+	// Operations without a TTL are not cached. Default TTLs are 1m for ListChannels
+	// and GetFileUrl, and 5m for GetTemplates.
+	TTLs map[string]time.Duration
+}
+
+type ctxKeyNoCache struct{}
+
+// WithoutCache returns a new context whose requests bypass the Cache middleware:
+// they are always sent, and their responses are not cached.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyNoCache{}, true)
+}
+
+// Cache is a middleware that caches successful responses of read operations.
+// Expired entries are revalidated with If-None-Match and If-Modified-Since
+// when the server supplied ETag or Last-Modified.
+//
+// Mutating calls invalidate the cached responses of their group: e.g. UpdateChannel invalidates
+// ListChannels, and ActivateTemplate, UpdateTemplate and DeactivateTemplate invalidate GetTemplates.
+// Responses are cached per transport token. Requests with a context from WithoutCache are passed as is.
+func Cache(s CacheSettings) Middleware {
+	if s.Store == nil {
+		s.Store = NewMemoryCacheStore(1000)
+	}
+	if s.TTLs == nil {
+		s.TTLs = map[string]time.Duration{
+			"ListChannels": time.Minute,
+			"GetFileUrl":   time.Minute,
+			"GetTemplates": 5 * time.Minute,
+		}
+	}
+
+	var gens cacheGenerations
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			op, ok := requestOperation(req)
+			if !ok {
+				return next.Do(req)
+			}
+
+			if req.Method != http.MethodGet {
+				resp, err := next.Do(req)
+				if err == nil && resp.StatusCode < http.StatusBadRequest && invalidatesCache(op) {
+					gens.bump(op.Group)
+				}
+				return resp, err
+			}
+
+			ttl := s.TTLs[op.ID]
+			if noCache, _ := req.Context().Value(ctxKeyNoCache{}).(bool); ttl <= 0 || noCache {
+				return next.Do(req)
+			}
+
+			key := cacheKey(req, gens.get(op.Group))
+
+			entry, ok := s.Store.Get(key)
+			if ok && time.Now().Before(entry.ExpiresAt) {
+				return entry.response(req), nil
+			}
+
+			upstream := req
+			if ok {
+				upstream = conditionalRequest(req, entry)
+			}
+
+			resp, err := next.Do(upstream)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok && upstream != req && resp.StatusCode == http.StatusNotModified {
+				drainBody(resp)
+
+				revalidated := *entry
+				revalidated.ExpiresAt = time.Now().Add(ttl)
+				s.Store.Set(key, &revalidated)
+
+				return revalidated.response(req), nil
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				return resp, nil
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			entry = &CacheEntry{
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header.Clone(),
+				Body:       body,
+				ExpiresAt:  time.Now().Add(ttl),
+			}
+			s.Store.Set(key, entry)
+
+			return entry.response(req), nil
+		})
+	}
+}
+
+func (e *CacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// conditionalRequest returns a copy of the request revalidating the entry,
+// or the request itself if the entry has no validators.
+func conditionalRequest(req *http.Request, entry *CacheEntry) *http.Request {
+	etag := entry.Header.Get("ETag")
+	lastModified := entry.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return req
+	}
+
+	r := req.Clone(req.Context())
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return r
+}
+
+// invalidatesCache reports whether the mutating operation changes cached responses.
+// File uploads create new files and do not change the URLs of existing ones.
+func invalidatesCache(op OperationInfo) bool {
+	return op.Group == OperationGroupChannels || op.Group == OperationGroupTemplates
+}
+
+// cacheKey builds the key from the group generation, transport token hash and URL.
+// The token is hashed, so that it is not exposed to external stores.
+func cacheKey(req *http.Request, generation uint64) string {
+	token := sha256.Sum256([]byte(req.Header.Get(transportTokenHeader)))
+
+	return strconv.FormatUint(generation, 10) + ":" + hex.EncodeToString(token[:8]) + ":" + req.URL.String()
+}
+
+// cacheGenerations invalidates cached responses by changing the generation
+// of an operation group, which is a part of the cache key.
+type cacheGenerations struct {
+	mu   sync.Mutex
+	gens map[OperationGroup]uint64
+}
+
+func (g *cacheGenerations) get(group OperationGroup) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.gens[group]
+}
+
+func (g *cacheGenerations) bump(group OperationGroup) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.gens == nil {
+		g.gens = make(map[OperationGroup]uint64)
+	}
+	g.gens[group]++
+}
@@ -0,0 +1,193 @@
+package transport_api_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func cachedDoer(calls *atomic.Int32, header http.Header) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		n := calls.Add(1)
+		if req.Method != http.MethodGet {
+			return &http.Response{StatusCode: 200, Body: http.NoBody, Header: make(http.Header)}, nil
+		}
+
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			return &http.Response{StatusCode: http.StatusNotModified, Body: http.NoBody, Header: make(http.Header)}, nil
+		}
+
+		return &http.Response{
+			StatusCode: 200,
+			Header:     header.Clone(),
+			Body:       io.NopCloser(strings.NewReader(`{"call": ` + string(rune('0'+n)) + `}`)),
+		}, nil
+	})
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(b)
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fresh response is served from cache", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{})(cachedDoer(&calls, http.Header{"Content-Type": []string{"application/json"}}))
+
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest("GET", "http://example.com/templates", nil)
+			resp, err := doer.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, 200, resp.StatusCode)
+			require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			require.Equal(t, `{"call": 1}`, readBody(t, resp))
+		}
+
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("responses are cached per URL and token", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{})(cachedDoer(&calls, make(http.Header)))
+
+		for _, tc := range []struct{ url, token string }{
+			{"http://example.com/channels?active=true", "a"},
+			{"http://example.com/channels?active=false", "a"},
+			{"http://example.com/channels?active=true", "b"},
+			{"http://example.com/channels?active=true", "a"},
+		} {
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			req.Header.Set("X-Transport-Token", tc.token)
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("operations without TTL are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{
+			TTLs: map[string]time.Duration{"GetTemplates": time.Minute},
+		})(cachedDoer(&calls, make(http.Header)))
+
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", "http://example.com/files/uuid", nil)
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("requests without cache bypass it", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{})(cachedDoer(&calls, make(http.Header)))
+
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+
+		req, _ = http.NewRequestWithContext(WithoutCache(context.Background()), "GET", "http://example.com/channels", nil)
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, `{"call": 2}`, readBody(t, resp))
+
+		req, _ = http.NewRequest("GET", "http://example.com/channels", nil)
+		resp, err = doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, `{"call": 1}`, readBody(t, resp), "bypassed response is not cached")
+	})
+
+	t.Run("mutating calls invalidate the group", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{})(cachedDoer(&calls, make(http.Header)))
+
+		get := func(url string) string {
+			req, _ := http.NewRequest("GET", url, nil)
+			resp, err := doer.Do(req)
+			require.NoError(t, err)
+			return readBody(t, resp)
+		}
+		do := func(method, url string) {
+			req, _ := http.NewRequest(method, url, nil)
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, `{"call": 1}`, get("http://example.com/channels"))
+		require.Equal(t, `{"call": 2}`, get("http://example.com/templates"))
+
+		do("PUT", "http://example.com/channels/1")
+		require.Equal(t, `{"call": 4}`, get("http://example.com/channels"))
+		require.Equal(t, `{"call": 2}`, get("http://example.com/templates"))
+
+		do("DELETE", "http://example.com/channels/1/templates/code")
+		require.Equal(t, `{"call": 4}`, get("http://example.com/channels"))
+		require.Equal(t, `{"call": 6}`, get("http://example.com/templates"))
+	})
+
+	t.Run("expired entry is revalidated with ETag", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{
+			TTLs: map[string]time.Duration{"ListChannels": 10 * time.Millisecond},
+		})(cachedDoer(&calls, http.Header{"Etag": []string{`"v1"`}}))
+
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, `{"call": 1}`, readBody(t, resp))
+
+		time.Sleep(20 * time.Millisecond)
+
+		resp, err = doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, `{"call": 1}`, readBody(t, resp))
+		require.Equal(t, int32(2), calls.Load())
+
+		// revalidated entry is fresh again
+		resp, err = doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, `{"call": 1}`, readBody(t, resp))
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("error responses are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Cache(CacheSettings{})(sequenceDoer(&calls, 500, 200))
+
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int32(2), calls.Load())
+	})
+}
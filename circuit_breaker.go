@@ -0,0 +1,282 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by the error returned by the CircuitBreaker middleware
+// when requests are rejected without being sent.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned by the CircuitBreaker middleware for rejected requests.
+type CircuitOpenError struct {
+	// Key identifies the circuit, e.g. "mg-s1.retailcrm.pro" or "mg-s1.retailcrm.pro SendMessage".
+	Key string
+	// Until is the time when the circuit switches to the half-open state.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCircuitOpen, e.Key)
+}
+
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// CircuitState is a state of a circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerSettings configures the CircuitBreaker middleware.
+// Zero fields are replaced with the default values.
+type CircuitBreakerSettings struct {
+	// PerOperation keys circuits by host and operation (e.g. SendMessage) instead of host only.
+	PerOperation bool
+	// Window is the period in which failures are counted in the closed state. Default is 10s.
+	Window time.Duration
+	// MinRequests is the number of requests in the window required to trip the circuit. Default is 10.
+	MinRequests int
+	// FailureRate is the fraction of failed requests in the window that trips the circuit. Default is 0.5.
+	FailureRate float64
+	// OpenTimeout is the time the circuit stays open before allowing probe requests. Default is 30s.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of successful probe requests required to close the circuit. Default is 1.
+	HalfOpenRequests int
+	// IsFailure reports whether the request result counts as a failure.
+	// By default network errors and 5xx responses are failures.
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called on every state transition of a circuit. It is called without
+	// holding the circuit lock, so transitions of concurrent requests may be reported out of order.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+func (s CircuitBreakerSettings) withDefaults() CircuitBreakerSettings {
+	if s.Window <= 0 {
+		s.Window = 10 * time.Second
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = 10
+	}
+	if s.FailureRate <= 0 || s.FailureRate > 1 {
+		s.FailureRate = 0.5
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 30 * time.Second
+	}
+	if s.HalfOpenRequests <= 0 {
+		s.HalfOpenRequests = 1
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = defaultIsFailure
+	}
+
+	return s
+}
+
+// CircuitBreaker is a middleware that stops sending requests to a host after too many failures.
+// While the circuit is open, requests fail immediately with *CircuitOpenError.
+// After OpenTimeout the circuit becomes half-open and lets probe requests through:
+// it closes after HalfOpenRequests successes, or opens again on the first failure.
+func CircuitBreaker(s CircuitBreakerSettings) Middleware {
+	s = s.withDefaults()
+
+	var (
+		mu       sync.Mutex
+		circuits = make(map[string]*circuit)
+	)
+
+	get := func(key string) *circuit {
+		mu.Lock()
+		defer mu.Unlock()
+
+		c, ok := circuits[key]
+		if !ok {
+			c = &circuit{key: key, settings: &s}
+			circuits[key] = c
+		}
+		return c
+	}
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			c := get(circuitKey(req, s.PerOperation))
+
+			generation, err := c.allow(time.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := next.Do(req)
+			if err != nil && errors.Is(err, context.Canceled) {
+				c.release(generation)
+				return resp, err
+			}
+
+			c.record(generation, time.Now(), s.IsFailure(resp, err))
+
+			return resp, err
+		})
+	}
+}
+
+func circuitKey(req *http.Request, perOperation bool) string {
+	if !perOperation {
+		return req.URL.Host
+	}
+
+	if op, ok := requestOperation(req); ok {
+		return req.URL.Host + " " + op.ID
+	}
+
+	return req.URL.Host + " " + req.Method + " " + req.URL.Path
+}
+
+func defaultIsFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+type circuit struct {
+	key      string
+	settings *CircuitBreakerSettings
+
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+	changes     []circuitStateChange
+	// generation is incremented on every state transition, so that the results of requests
+	// admitted in an earlier state are ignored.
+	generation uint64
+}
+
+type circuitStateChange struct {
+	from, to CircuitState
+}
+
+// allow checks whether a request may be sent and reserves a probe slot in the half-open state.
+// It returns the generation of the circuit state, which the result of the request is recorded for.
+func (c *circuit) allow(now time.Time) (uint64, error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		until := c.openedAt.Add(c.settings.OpenTimeout)
+		if now.Before(until) {
+			return 0, &CircuitOpenError{Key: c.key, Until: until}
+		}
+		c.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= c.settings.HalfOpenRequests {
+			return 0, &CircuitOpenError{Key: c.key, Until: now}
+		}
+		c.probes++
+	default:
+		if now.Sub(c.windowStart) > c.settings.Window {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+	}
+
+	return c.generation, nil
+}
+
+// release frees a probe slot reserved by allow without recording a result.
+func (c *circuit) release(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation && c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// record applies the result of a request admitted in the given generation.
+// Results of requests admitted before the last state transition are ignored.
+func (c *circuit) record(generation uint64, now time.Time, failed bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			c.open(now)
+			return
+		}
+
+		c.successes++
+		if c.successes >= c.settings.HalfOpenRequests {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+			c.setState(CircuitClosed)
+		}
+	case CircuitClosed:
+		c.requests++
+		if failed {
+			c.failures++
+		}
+
+		if c.requests >= c.settings.MinRequests &&
+			float64(c.failures)/float64(c.requests) >= c.settings.FailureRate {
+			c.open(now)
+		}
+	}
+}
+
+func (c *circuit) open(now time.Time) {
+	c.openedAt = now
+	c.setState(CircuitOpen)
+}
+
+func (c *circuit) setState(state CircuitState) {
+	from := c.state
+	c.state = state
+	c.probes, c.successes = 0, 0
+	c.generation++
+
+	if c.settings.OnStateChange != nil && from != state {
+		c.changes = append(c.changes, circuitStateChange{from: from, to: state})
+	}
+}
+
+// unlock releases the circuit lock and then reports the state transitions made while holding it.
+func (c *circuit) unlock() {
+	changes := c.changes
+	c.changes = nil
+	c.mu.Unlock()
+
+	for _, ch := range changes {
+		c.settings.OnStateChange(c.key, ch.from, ch.to)
+	}
+}
@@ -0,0 +1,236 @@
+package transport_api_client
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("circuit opens on failure rate and rejects requests", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := CircuitBreaker(CircuitBreakerSettings{
+			MinRequests: 4,
+			FailureRate: 0.5,
+			OpenTimeout: time.Minute,
+		})(sequenceDoer(&calls, 200, 500, 200, 500, 200))
+
+		for i := 0; i < 4; i++ {
+			req, _ := http.NewRequest("POST", "http://mg.example.com/messages", nil)
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		req, _ := http.NewRequest("POST", "http://mg.example.com/messages/ack", nil)
+		resp, err := doer.Do(req)
+
+		require.Nil(t, resp)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+
+		var openErr *CircuitOpenError
+		require.ErrorAs(t, err, &openErr)
+		require.Equal(t, "mg.example.com", openErr.Key)
+		require.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("circuit stays closed below min requests", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := CircuitBreaker(CircuitBreakerSettings{MinRequests: 10})(sequenceDoer(&calls, 503))
+
+		for i := 0; i < 9; i++ {
+			req, _ := http.NewRequest("GET", "http://mg.example.com/channels", nil)
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("half-open probe closes the circuit", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu          sync.Mutex
+			transitions []string
+		)
+
+		var calls atomic.Int32
+		doer := CircuitBreaker(CircuitBreakerSettings{
+			MinRequests: 1,
+			OpenTimeout: 20 * time.Millisecond,
+			OnStateChange: func(key string, from, to CircuitState) {
+				mu.Lock()
+				defer mu.Unlock()
+				transitions = append(transitions, from.String()+"->"+to.String())
+			},
+		})(sequenceDoer(&calls, 500, 200))
+
+		req, _ := http.NewRequest("GET", "http://mg.example.com/channels", nil)
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+
+		_, err = doer.Do(req)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+
+		time.Sleep(30 * time.Millisecond)
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, transitions)
+	})
+
+	t.Run("state change callback can send requests", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			calls    atomic.Int32
+			doer     HttpRequestDoer
+			probeErr = make(chan error, 1)
+		)
+		doer = CircuitBreaker(CircuitBreakerSettings{
+			MinRequests: 1,
+			OnStateChange: func(key string, from, to CircuitState) {
+				req, _ := http.NewRequest("GET", "http://mg.example.com/channels", nil)
+				_, err := doer.Do(req)
+				probeErr <- err
+			},
+		})(sequenceDoer(&calls, 500))
+
+		req, _ := http.NewRequest("GET", "http://mg.example.com/channels", nil)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = doer.Do(req)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("state change callback is called under the circuit lock")
+		}
+		require.ErrorIs(t, <-probeErr, ErrCircuitOpen)
+	})
+
+	t.Run("results of requests admitted before a transition are ignored", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu          sync.Mutex
+			transitions []string
+		)
+		release := map[string]chan int{"/slow": make(chan int), "/probe": make(chan int)}
+		doer := CircuitBreaker(CircuitBreakerSettings{
+			MinRequests: 1,
+			OpenTimeout: 20 * time.Millisecond,
+			OnStateChange: func(key string, from, to CircuitState) {
+				mu.Lock()
+				defer mu.Unlock()
+				transitions = append(transitions, from.String()+"->"+to.String())
+			},
+		})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			status := 500
+			if ch, ok := release[req.URL.Path]; ok {
+				status = <-ch
+			}
+			return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+		}))
+
+		do := func(path string) error {
+			req, _ := http.NewRequest("GET", "http://mg.example.com"+path, nil)
+			_, err := doer.Do(req)
+			return err
+		}
+		started := func(path string) chan error {
+			done := make(chan error, 1)
+			go func() { done <- do(path) }()
+			return done
+		}
+
+		// a slow request is admitted while the circuit is closed, then a failure opens it
+		slow := started("/slow")
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, do("/fail"))
+
+		// the probe is admitted in the half-open state
+		time.Sleep(30 * time.Millisecond)
+		probe := started("/probe")
+		time.Sleep(10 * time.Millisecond)
+
+		// the slow request succeeds, but it must not close the circuit
+		release["/slow"] <- 200
+		require.NoError(t, <-slow)
+		require.ErrorIs(t, do("/other"), ErrCircuitOpen, "the probe slot is still taken")
+
+		release["/probe"] <- 200
+		require.NoError(t, <-probe)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, transitions)
+	})
+
+	t.Run("failed probe opens the circuit again", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := CircuitBreaker(CircuitBreakerSettings{
+			MinRequests: 1,
+			OpenTimeout: 20 * time.Millisecond,
+		})(sequenceDoer(&calls, 500))
+
+		req, _ := http.NewRequest("GET", "http://mg.example.com/channels", nil)
+		_, _ = doer.Do(req)
+
+		time.Sleep(30 * time.Millisecond)
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+
+		_, err = doer.Do(req)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("circuits are keyed per operation", func(t *testing.T) {
+		t.Parallel()
+
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodPost {
+				return nil, errors.New("connection reset")
+			}
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})
+
+		doer := CircuitBreaker(CircuitBreakerSettings{
+			PerOperation: true,
+			MinRequests:  1,
+			OpenTimeout:  time.Minute,
+		})(next)
+
+		send, _ := http.NewRequest("POST", "http://mg.example.com/messages", nil)
+		_, err := doer.Do(send)
+		require.Error(t, err)
+
+		_, err = doer.Do(send)
+		var openErr *CircuitOpenError
+		require.ErrorAs(t, err, &openErr)
+		require.Equal(t, "mg.example.com SendMessage", openErr.Key)
+
+		list, _ := http.NewRequest("GET", "http://mg.example.com/channels", nil)
+		_, err = doer.Do(list)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,243 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoTenant is returned by a ClientPool for requests without a tenant key in the context.
+var ErrNoTenant = errors.New("tenant is not set in the context")
+
+// poolServer is the server of the pool client. Requests are sent to the BaseURL of their tenant instead.
+const poolServer = "http://client-pool.invalid/"
+
+// Tenant is the configuration of a ClientPool tenant, e.g. a retailCRM account.
+type Tenant struct {
+	// BaseURL is the MG Transport API URL of the tenant, e.g. "https://mg-s1.retailcrm.pro/api/transport/v1/".
+	BaseURL string
+	// Token resolves the transport token of the tenant.
+	Token TokenProvider
+	// Middlewares are applied to the requests of the tenant only, after the shared middlewares,
+	// e.g. a Limiter with its own RateLimiter.
+	Middlewares []Middleware
+}
+
+// TenantResolver returns the configuration of the tenant with the key.
+// It is called when the tenant is used for the first time or after it was evicted.
+type TenantResolver func(ctx context.Context, key string) (Tenant, error)
+
+// ClientPoolSettings configures a ClientPool.
+type ClientPoolSettings struct {
+	// Resolver returns the configuration of tenants. Required.
+	Resolver TenantResolver
+	// HTTPClient sends the requests of all tenants, so that they share one http.Transport.
+	// Default is an http.Client with http.DefaultTransport.
+	HTTPClient HttpRequestDoer
+	// Middlewares are shared by all tenants, e.g. Logging or Metrics.
+	Middlewares []Middleware
+	// IdleTimeout is the time after which unused tenants are evicted. Default is 30 minutes.
+	IdleTimeout time.Duration
+}
+
+// ClientPool is a client for many tenants with their own base URL and transport token.
+// The tenant of a request is taken from its context, see WithTenant, so the pool is used as
+// any other ClientInterface or ClientWithResponsesInterface. It is safe for concurrent use.
+//
+// Tenants are resolved lazily on their first request. Tenants without requests for IdleTimeout
+// are evicted, which is checked on requests at most once per IdleTimeout.
+// All tenants share the HTTP client and the Middlewares; the Tenant.Middlewares and token are per tenant.
+type ClientPool struct {
+	*ClientWithResponses
+
+	s     ClientPoolSettings
+	locks keyedMutex
+
+	mu        sync.Mutex
+	tenants   map[string]*pooledTenant
+	lastSweep time.Time
+}
+
+var (
+	_ ClientInterface              = (*ClientPool)(nil)
+	_ ClientWithResponsesInterface = (*ClientPool)(nil)
+)
+
+type pooledTenant struct {
+	baseURL  *url.URL
+	token    TokenProvider
+	doer     HttpRequestDoer
+	lastUsed time.Time
+}
+
+type ctxKeyTenant struct{}
+
+// WithTenant returns a new context with the tenant key used by ClientPool.
+func WithTenant(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxKeyTenant{}, key)
+}
+
+// TenantFromContext returns the tenant key stored in the context.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(ctxKeyTenant{}).(string)
+	return key, ok && key != ""
+}
+
+// NewClientPool creates a ClientPool.
+func NewClientPool(s ClientPoolSettings) (*ClientPool, error) {
+	if s.Resolver == nil {
+		return nil, errors.New("client pool: resolver is required")
+	}
+	if s.HTTPClient == nil {
+		s.HTTPClient = &http.Client{}
+	}
+	if s.IdleTimeout <= 0 {
+		s.IdleTimeout = 30 * time.Minute
+	}
+
+	p := &ClientPool{
+		s:         s,
+		tenants:   make(map[string]*pooledTenant),
+		lastSweep: time.Now(),
+	}
+
+	mws := append([]Middleware{p.routeTenant}, s.Middlewares...)
+	c, err := NewClientWithResponses(poolServer, WithHTTPClient(DoerFunc(p.dispatch)), WithMiddlewares(mws...))
+	if err != nil {
+		return nil, err
+	}
+	p.ClientWithResponses = c
+
+	return p, nil
+}
+
+// Evict removes the tenant, so that it is resolved again on the next request,
+// e.g. after its base URL has changed.
+func (p *ClientPool) Evict(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.tenants, key)
+}
+
+// Len returns the number of resolved tenants.
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.tenants)
+}
+
+// routeTenant sends the request to the base URL of its tenant with the tenant token,
+// so that the shared middlewares see the final request.
+func (p *ClientPool) routeTenant(next HttpRequestDoer) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		key, ok := TenantFromContext(req.Context())
+		if !ok {
+			return nil, ErrNoTenant
+		}
+
+		t, err := p.tenant(req.Context(), key)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := t.token.Token(req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(context.WithValue(req.Context(), ctxKeyPooledTenant{}, t))
+		req.URL = t.baseURL.ResolveReference(&url.URL{
+			Path:     strings.TrimPrefix(req.URL.Path, "/"),
+			RawPath:  strings.TrimPrefix(req.URL.RawPath, "/"),
+			RawQuery: req.URL.RawQuery,
+		})
+		req.Host = ""
+		req.Header.Set(transportTokenHeader, token)
+
+		return refreshTokenOnUnauthorized(t.token)(next).Do(req)
+	})
+}
+
+type ctxKeyPooledTenant struct{}
+
+// dispatch sends the request through the middlewares of its tenant.
+func (p *ClientPool) dispatch(req *http.Request) (*http.Response, error) {
+	t, ok := req.Context().Value(ctxKeyPooledTenant{}).(*pooledTenant)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	return t.doer.Do(req)
+}
+
+// tenant returns the resolved tenant, resolving it on first use. Concurrent requests
+// of a new tenant wait for one Resolver call.
+func (p *ClientPool) tenant(ctx context.Context, key string) (*pooledTenant, error) {
+	if t, ok := p.cachedTenant(key); ok {
+		return t, nil
+	}
+
+	unlock := p.locks.lock(key)
+	defer unlock()
+
+	if t, ok := p.cachedTenant(key); ok {
+		return t, nil
+	}
+
+	cfg, err := p.s.Resolver(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token == nil {
+		return nil, ErrNoToken
+	}
+
+	baseURL, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+
+	t := &pooledTenant{baseURL: baseURL, token: cfg.Token, doer: p.s.HTTPClient, lastUsed: time.Now()}
+	for i := len(cfg.Middlewares) - 1; i >= 0; i-- {
+		t.doer = cfg.Middlewares[i](t.doer)
+	}
+
+	p.mu.Lock()
+	p.tenants[key] = t
+	p.mu.Unlock()
+
+	return t, nil
+}
+
+// cachedTenant returns a resolved tenant, and evicts idle tenants at most once per IdleTimeout.
+func (p *ClientPool) cachedTenant(key string) (*pooledTenant, bool) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.lastSweep) >= p.s.IdleTimeout {
+		for k, t := range p.tenants {
+			if now.Sub(t.lastUsed) >= p.s.IdleTimeout {
+				delete(p.tenants, k)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	t, ok := p.tenants[key]
+	if ok {
+		t.lastUsed = now
+	}
+
+	return t, ok
+}
@@ -0,0 +1,198 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPool(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(t *testing.T, token string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(transportTokenHeader) != token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"id": 1, "name": "` + token + `"}]`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	t.Run("requests are routed to their tenant", func(t *testing.T) {
+		t.Parallel()
+
+		servers := map[string]*httptest.Server{
+			"a": newServer(t, "token-a"),
+			"b": newServer(t, "token-b"),
+		}
+
+		var (
+			resolved   atomic.Int32
+			mu         sync.Mutex
+			sharedSeen []string
+			tenantSeen []string
+		)
+		shared := func(next HttpRequestDoer) HttpRequestDoer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				sharedSeen = append(sharedSeen, req.URL.Host+" "+req.Header.Get(transportTokenHeader))
+				mu.Unlock()
+				return next.Do(req)
+			})
+		}
+		onlyB := func(next HttpRequestDoer) HttpRequestDoer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				tenantSeen = append(tenantSeen, req.URL.Path)
+				mu.Unlock()
+				return next.Do(req)
+			})
+		}
+
+		pool, err := NewClientPool(ClientPoolSettings{
+			Resolver: func(_ context.Context, key string) (Tenant, error) {
+				resolved.Add(1)
+				tenant := Tenant{BaseURL: servers[key].URL + "/api/transport/v1", Token: StaticToken("token-" + key)}
+				if key == "b" {
+					tenant.Middlewares = []Middleware{onlyB}
+				}
+				return tenant, nil
+			},
+			Middlewares: []Middleware{shared},
+		})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for range 5 {
+			for _, key := range []string{"a", "b"} {
+				wg.Go(func() {
+					resp, err := pool.ListChannelsWithResponse(WithTenant(context.Background(), key), nil)
+					require.NoError(t, err)
+					require.Equal(t, http.StatusOK, resp.StatusCode())
+					require.Equal(t, "token-"+key, *(*resp.JSON200)[0].Name)
+				})
+			}
+		}
+		wg.Wait()
+
+		require.EqualValues(t, 2, resolved.Load(), "tenants are resolved once")
+		require.Equal(t, 2, pool.Len())
+		require.Len(t, sharedSeen, 10)
+		require.Contains(t, sharedSeen, strings.TrimPrefix(servers["a"].URL, "http://")+" token-a")
+		require.Len(t, tenantSeen, 5)
+		require.Equal(t, "/api/transport/v1/channels", tenantSeen[0])
+	})
+
+	t.Run("escaped path parameters are kept", func(t *testing.T) {
+		t.Parallel()
+
+		paths := make(chan string, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.EscapedPath()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		t.Cleanup(srv.Close)
+
+		pool, err := NewClientPool(ClientPoolSettings{
+			Resolver: func(context.Context, string) (Tenant, error) {
+				return Tenant{BaseURL: srv.URL + "/api/transport/v1", Token: StaticToken("token")}, nil
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = pool.UpdateTemplateWithResponse(WithTenant(context.Background(), "a"), 1, "a/b c", UpdateTemplateJSONRequestBody{})
+		require.NoError(t, err)
+		require.Equal(t, "/api/transport/v1/channels/1/templates/a%2Fb%20c", <-paths)
+	})
+
+	t.Run("requests without a tenant fail", func(t *testing.T) {
+		t.Parallel()
+
+		pool, err := NewClientPool(ClientPoolSettings{
+			Resolver: func(context.Context, string) (Tenant, error) { return Tenant{}, nil },
+		})
+		require.NoError(t, err)
+
+		_, err = pool.ListChannels(context.Background(), nil)
+		require.ErrorIs(t, err, ErrNoTenant)
+	})
+
+	t.Run("resolver errors are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		srv := newServer(t, "token")
+		fail := true
+		pool, err := NewClientPool(ClientPoolSettings{
+			Resolver: func(context.Context, string) (Tenant, error) {
+				if fail {
+					return Tenant{}, errors.New("account not found")
+				}
+				return Tenant{BaseURL: srv.URL, Token: StaticToken("token")}, nil
+			},
+		})
+		require.NoError(t, err)
+
+		ctx := WithTenant(context.Background(), "a")
+		_, err = pool.ListChannels(ctx, nil)
+		require.EqualError(t, err, "account not found")
+
+		fail = false
+		resp, err := pool.ListChannels(ctx, nil)
+		require.NoError(t, err)
+		readBody(t, resp)
+	})
+
+	t.Run("idle tenants are evicted", func(t *testing.T) {
+		t.Parallel()
+
+		synctest.Test(t, func(t *testing.T) {
+			var resolved atomic.Int32
+			pool, err := NewClientPool(ClientPoolSettings{
+				Resolver: func(_ context.Context, key string) (Tenant, error) {
+					resolved.Add(1)
+					return Tenant{BaseURL: "http://" + key + ".example.com", Token: StaticToken("token")}, nil
+				},
+				HTTPClient: DoerFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				IdleTimeout: time.Minute,
+			})
+			require.NoError(t, err)
+
+			call := func(key string) {
+				_, err := pool.ListChannels(WithTenant(context.Background(), key), nil)
+				require.NoError(t, err)
+			}
+
+			call("a")
+			call("b")
+			time.Sleep(40 * time.Second)
+			call("a")
+			time.Sleep(40 * time.Second)
+			call("a")
+
+			require.Equal(t, 1, pool.Len(), "b was idle for a minute")
+			require.EqualValues(t, 2, resolved.Load())
+
+			call("b")
+			require.EqualValues(t, 3, resolved.Load())
+
+			pool.Evict("a")
+			call("a")
+			require.EqualValues(t, 4, resolved.Load())
+		})
+	})
+}
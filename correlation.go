@@ -0,0 +1,87 @@
+package transport_api_client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// CorrelationIDHeader is the header carrying the correlation ID of incoming webhooks and outbound calls.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// correlationIDHeaders are the headers of incoming requests checked for a correlation ID, in order.
+var correlationIDHeaders = []string{CorrelationIDHeader, "X-Request-ID"}
+
+type ctxKeyCorrelationID struct{}
+
+// WithCorrelationID returns a new context with the correlation ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyCorrelationID{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID stored in the context.
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKeyCorrelationID{}).(string)
+	return id, ok && id != ""
+}
+
+// NewCorrelationID generates a random correlation ID.
+func NewCorrelationID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// CorrelationID is a middleware that sends the correlation ID from the request context
+// in the X-Correlation-ID header. Requests without one get a new ID, which is also put
+// into the request context, so that the next middlewares such as Logging can read it.
+//
+// Use CorrelationHandler for webhooks, so that the calls made while handling a webhook
+// share its correlation ID.
+func CorrelationID() Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			id, ok := CorrelationIDFromContext(req.Context())
+			if !ok {
+				id = NewCorrelationID()
+				req = req.WithContext(WithCorrelationID(req.Context(), id))
+			}
+
+			req.Header = req.Header.Clone()
+			req.Header.Set(CorrelationIDHeader, id)
+
+			return next.Do(req)
+		})
+	}
+}
+
+// CorrelationHandler is a net/http middleware for webhook handlers. It takes the correlation ID
+// from the X-Correlation-ID or X-Request-ID header of the incoming request, or generates a new one,
+// puts it into the request context and returns it in the X-Correlation-ID response header.
+//
+// Handlers read it with CorrelationIDFromContext, and client calls made with the request context
+// send it with the CorrelationID middleware.
+func CorrelationHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := incomingCorrelationID(r)
+		w.Header().Set(CorrelationIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithCorrelationID(r.Context(), id)))
+	})
+}
+
+// incomingCorrelationID returns the correlation ID of the incoming request from its context or headers,
+// or a new one.
+func incomingCorrelationID(r *http.Request) string {
+	if id, ok := CorrelationIDFromContext(r.Context()); ok {
+		return id
+	}
+
+	for _, h := range correlationIDHeaders {
+		if id := r.Header.Get(h); id != "" {
+			return id
+		}
+	}
+
+	return NewCorrelationID()
+}
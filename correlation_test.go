@@ -0,0 +1,119 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(CorrelationIDHeader)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	t.Run("id from context is sent and logged", func(t *testing.T) {
+		var buf bytes.Buffer
+		c, err := NewClient(srv.URL, WithMiddlewares(
+			CorrelationID(),
+			Logging(NewDefaultLogger(log.New(&buf, "", 0))),
+		))
+		require.NoError(t, err)
+
+		resp, err := c.ListChannels(WithCorrelationID(context.Background(), "abc"), nil)
+		require.NoError(t, err)
+		readBody(t, resp)
+
+		require.Equal(t, "abc", received)
+		require.Contains(t, buf.String(), "[correlation_id=abc]")
+	})
+
+	t.Run("id is generated when missing", func(t *testing.T) {
+		var seen string
+		capture := func(next HttpRequestDoer) HttpRequestDoer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				seen, _ = CorrelationIDFromContext(req.Context())
+				return next.Do(req)
+			})
+		}
+
+		c, err := NewClient(srv.URL, WithMiddlewares(CorrelationID(), capture))
+		require.NoError(t, err)
+
+		resp, err := c.ListChannels(context.Background(), nil)
+		require.NoError(t, err)
+		readBody(t, resp)
+
+		require.Len(t, seen, 32)
+		require.Equal(t, seen, received)
+	})
+
+	t.Run("webhook id is passed to client calls", func(t *testing.T) {
+		c, err := NewClient(srv.URL, WithMiddlewares(CorrelationID()))
+		require.NoError(t, err)
+
+		var inHandler string
+		h := CorrelationHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inHandler, _ = CorrelationIDFromContext(r.Context())
+
+			resp, err := c.ListChannels(r.Context(), nil)
+			require.NoError(t, err)
+			readBody(t, resp)
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		req.Header.Set("X-Request-ID", "from-mg")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		require.Equal(t, "from-mg", inHandler)
+		require.Equal(t, "from-mg", received)
+		require.Equal(t, "from-mg", rec.Header().Get(CorrelationIDHeader))
+	})
+
+	t.Run("webhook without id gets a new one", func(t *testing.T) {
+		var inHandler string
+		h := CorrelationHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inHandler, _ = CorrelationIDFromContext(r.Context())
+		}))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+
+		require.NotEmpty(t, inHandler)
+		require.Equal(t, inHandler, rec.Header().Get(CorrelationIDHeader))
+	})
+}
+
+func TestCorrelationIDStructuredLogging(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c, err := NewClient(srv.URL, WithMiddlewares(
+		CorrelationID(),
+		Logging(NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))),
+	))
+	require.NoError(t, err)
+
+	resp, err := c.ListChannels(WithCorrelationID(context.Background(), "abc"), nil)
+	require.NoError(t, err)
+	readBody(t, resp)
+
+	require.Contains(t, buf.String(), `"correlation_id":"abc"`)
+}
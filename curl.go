@@ -0,0 +1,229 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CurlTokenVariable is the shell variable that replaces the transport token in curl commands.
+const CurlTokenVariable = "MG_TRANSPORT_TOKEN"
+
+// CurlCommand returns a runnable curl command reproducing the request, with the transport token
+// replaced by $MG_TRANSPORT_TOKEN and the body inlined. Files of multipart requests, e.g. UploadFileWithBody,
+// are replaced by @<file name> placeholders, and other non-JSON bodies by @body.bin.
+//
+// The request body is buffered if it can't be read again, so the request can still be sent.
+func CurlCommand(req *http.Request) (string, error) {
+	if err := ensureGetBody(req); err != nil {
+		return "", err
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		body, err = io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	multipartBody := strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != ""
+
+	var b strings.Builder
+	b.WriteString("curl -X " + req.Method + " " + shellQuote(req.URL.String()))
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch {
+		case http.CanonicalHeaderKey(k) == "Content-Length":
+			continue
+		case multipartBody && http.CanonicalHeaderKey(k) == "Content-Type":
+			// curl sets it with its own boundary for -F
+			continue
+		}
+		for _, v := range req.Header[k] {
+			if http.CanonicalHeaderKey(k) == transportTokenHeader {
+				b.WriteString(" \\\n  -H \"" + transportTokenHeader + ": $" + CurlTokenVariable + "\"")
+				continue
+			}
+			b.WriteString(" \\\n  -H " + shellQuote(k+": "+v))
+		}
+	}
+
+	switch {
+	case len(body) == 0:
+	case multipartBody:
+		fields, err := curlFormFields(body, params["boundary"])
+		if err != nil {
+			return "", err
+		}
+		for _, f := range fields {
+			b.WriteString(" \\\n  -F " + shellQuote(f))
+		}
+	case mediaType == "" || strings.HasSuffix(mediaType, "json") || strings.HasPrefix(mediaType, "text/"):
+		b.WriteString(" \\\n  --data-raw " + shellQuote(string(body)))
+	default:
+		b.WriteString(" \\\n  --data-binary @body.bin")
+	}
+
+	return b.String(), nil
+}
+
+// curlFormFields returns the -F arguments of a multipart body, with files replaced by placeholders.
+func curlFormFields(body []byte, boundary string) ([]string, error) {
+	r := multipart.NewReader(strings.NewReader(string(body)), boundary)
+
+	var fields []string
+	for {
+		part, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if name := part.FileName(); name != "" {
+			field := part.FormName() + "=@" + name
+			if ct := part.Header.Get("Content-Type"); ct != "" {
+				field += ";type=" + ct
+			}
+			fields = append(fields, field)
+			continue
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, part.FormName()+"="+string(value))
+	}
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// FailedRequest describes a request that failed, passed to CurlSettings.OnFailure.
+type FailedRequest struct {
+	// Operation is the API operation ID, or "METHOD path" for other requests.
+	Operation string
+	// Curl is the curl command reproducing the request, see CurlCommand.
+	Curl string
+	// Status is the response status code, or 0 if no response was received.
+	Status int
+	// Errors are the errors of the ErrorResponse body.
+	Errors []string
+	// Err is the transport error of requests without a response.
+	Err error
+}
+
+// CurlSettings configures the CurlOnFailure middleware.
+type CurlSettings struct {
+	// Logger logs failed requests with their curl command with LogLevelError.
+	Logger Logger
+	// OnFailure is called for each failed request.
+	OnFailure func(ctx context.Context, f FailedRequest)
+	// IsFailure decides whether a request failed.
+	// Default is a transport error or a 4xx or 5xx status code.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// CurlOnFailure is a middleware that turns failed requests into curl commands, see CurlCommand,
+// and passes them to the Logger and OnFailure of the settings, e.g. to send a reproducible request
+// to MG support. If the Logger is a StructuredLogger, requests are logged with the attributes
+// operation, status, errors, error and curl.
+//
+// The commands contain message texts and customer data, so don't send them to shared logs in production.
+func CurlOnFailure(s CurlSettings) Middleware {
+	if s.IsFailure == nil {
+		s.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= http.StatusBadRequest
+		}
+	}
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := ensureGetBody(req); err != nil {
+				return nil, err
+			}
+
+			resp, err := next.Do(req)
+			if !s.IsFailure(resp, err) {
+				return resp, err
+			}
+
+			f := FailedRequest{Operation: operationName(req), Err: err}
+			if resp != nil {
+				f.Status = resp.StatusCode
+				f.Errors = responseErrors(resp)
+			}
+
+			f.Curl, err = CurlCommand(req)
+			if err != nil {
+				f.Curl = "<failed to build curl command: " + err.Error() + ">"
+			}
+
+			if s.Logger != nil {
+				logFailedRequest(req.Context(), s.Logger, f)
+			}
+			if s.OnFailure != nil {
+				s.OnFailure(req.Context(), f)
+			}
+
+			return resp, f.Err
+		})
+	}
+}
+
+func logFailedRequest(ctx context.Context, l Logger, f FailedRequest) {
+	errText := ""
+	if f.Err != nil {
+		errText = f.Err.Error()
+	}
+
+	if sl, ok := l.(StructuredLogger); ok {
+		attrs := []slog.Attr{
+			slog.String("operation", f.Operation),
+			slog.Int("status", f.Status),
+		}
+		if len(f.Errors) > 0 {
+			attrs = append(attrs, slog.Any("errors", f.Errors))
+		}
+		if errText != "" {
+			attrs = append(attrs, slog.String("error", errText))
+		}
+		attrs = append(attrs, slog.String("curl", f.Curl))
+		sl.LogAttrs(ctx, LogLevelError, "HTTP request failed, reproduce with curl", attrs...)
+		return
+	}
+
+	reason := errText
+	if reason == "" {
+		reason = strconv.Itoa(f.Status)
+		if len(f.Errors) > 0 {
+			reason += " " + strings.Join(f.Errors, "; ")
+		}
+	}
+
+	l.Log(WithLogLevel(ctx, LogLevelError), "%s failed: %s, reproduce with:\n%s", f.Operation, reason, f.Curl)
+}
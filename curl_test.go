@@ -0,0 +1,158 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurlCommand(t *testing.T) {
+	t.Parallel()
+
+	t.Run("JSON body is inlined and token is masked", func(t *testing.T) {
+		t.Parallel()
+
+		req, _ := NewSendMessageRequest("https://mg.example.com/api/transport/v1/", SendMessageJSONRequestBody{
+			Channel: 1,
+			Message: SendMessageRequestMessage{Text: "it's"},
+		})
+		req.Header.Set(transportTokenHeader, "secret-token")
+
+		cmd, err := CurlCommand(req)
+		require.NoError(t, err)
+
+		require.True(t, strings.HasPrefix(cmd, "curl -X POST 'https://mg.example.com/api/transport/v1/messages'"))
+		require.Contains(t, cmd, `-H "X-Transport-Token: $MG_TRANSPORT_TOKEN"`)
+		require.Contains(t, cmd, `-H 'Content-Type: application/json'`)
+		require.Contains(t, cmd, `"text":"it'\''s"`)
+		require.NotContains(t, cmd, "secret-token")
+
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), `"channel":1`, "request body is still readable")
+	})
+
+	t.Run("multipart files are replaced by placeholders", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		fw, err := w.CreateFormFile("file", "photo.jpg")
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte("\xff\xd8binary"))
+		require.NoError(t, w.Close())
+
+		req, _ := NewUploadFileRequestWithBody("https://mg.example.com/api/transport/v1/", w.FormDataContentType(), &buf)
+
+		cmd, err := CurlCommand(req)
+		require.NoError(t, err)
+
+		require.Contains(t, cmd, `-F 'file=@photo.jpg;type=application/octet-stream'`)
+		require.NotContains(t, cmd, "binary")
+		require.NotContains(t, cmd, "Content-Type")
+	})
+
+	t.Run("command is runnable", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := exec.LookPath("curl"); err != nil {
+			t.Skip("curl is not installed")
+		}
+
+		type received struct{ token, body string }
+		got := make(chan received, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			got <- received{token: r.Header.Get(transportTokenHeader), body: string(b)}
+		}))
+		t.Cleanup(srv.Close)
+
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/messages", strings.NewReader(`{"text":"it's"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(transportTokenHeader, "secret-token")
+
+		cmd, err := CurlCommand(req)
+		require.NoError(t, err)
+
+		sh := exec.Command("sh", "-c", cmd+" --silent")
+		sh.Env = append(os.Environ(), CurlTokenVariable+"=env-token")
+		out, err := sh.CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		require.Equal(t, received{token: "env-token", body: `{"text":"it's"}`}, <-got)
+	})
+}
+
+func TestCurlOnFailure(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/messages" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": ["invalid channel"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("failed requests are logged and passed to the callback", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			buf    bytes.Buffer
+			failed []FailedRequest
+		)
+		c, err := NewClientWithResponses(srv.URL, WithMiddlewares(CurlOnFailure(CurlSettings{
+			Logger:    NewDefaultLogger(log.New(&buf, "", 0)),
+			OnFailure: func(_ context.Context, f FailedRequest) { failed = append(failed, f) },
+		})), WithTransportToken("secret-token"))
+		require.NoError(t, err)
+
+		_, err = c.ListChannelsWithResponse(context.Background(), nil)
+		require.NoError(t, err)
+
+		resp, err := c.SendMessageWithResponse(context.Background(), SendMessageJSONRequestBody{Channel: 1})
+		require.NoError(t, err)
+		require.Equal(t, []string{"invalid channel"}, resp.JSONDefault.Errors, "response body is restored")
+
+		require.Len(t, failed, 1)
+		require.Equal(t, "SendMessage", failed[0].Operation)
+		require.Equal(t, http.StatusBadRequest, failed[0].Status)
+		require.Equal(t, []string{"invalid channel"}, failed[0].Errors)
+		require.Contains(t, failed[0].Curl, "--data-raw")
+
+		require.Contains(t, buf.String(), "[ERROR] SendMessage failed: 400 invalid channel, reproduce with:\ncurl -X POST")
+		require.NotContains(t, buf.String(), "secret-token")
+	})
+
+	t.Run("transport errors are reported", func(t *testing.T) {
+		t.Parallel()
+
+		var failed FailedRequest
+		doer := CurlOnFailure(CurlSettings{
+			OnFailure: func(_ context.Context, f FailedRequest) { failed = f },
+		})(DoerFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection reset")
+		}))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/channels", nil)
+		_, err := doer.Do(req)
+		require.EqualError(t, err, "connection reset")
+
+		require.EqualError(t, failed.Err, "connection reset")
+		require.Equal(t, "curl -X GET 'http://example.com/channels'", failed.Curl)
+	})
+}
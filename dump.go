@@ -0,0 +1,320 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// DefaultRedactHeaders are the headers redacted by the Dump middleware by default.
+var DefaultRedactHeaders = []string{transportTokenHeader, "Authorization", "Cookie", "Set-Cookie"}
+
+// DefaultRedactFields are the JSON fields redacted by the Dump middleware by default:
+// customer contacts and names, avatar URLs and file URLs.
+var DefaultRedactFields = []string{
+	"phone", "email", "first_name", "last_name", "nickname", "username",
+	"avatar", "avatar_url", "profile_url", "url", "preview_url",
+}
+
+// DumpSettings configures the Dump middleware.
+type DumpSettings struct {
+	// RedactHeaders are the redacted request and response headers. Default is DefaultRedactHeaders.
+	RedactHeaders []string
+	// RedactFields are the names of JSON object fields redacted at any depth. Default is DefaultRedactFields.
+	RedactFields []string
+	// RedactPaths are dot-separated paths of redacted JSON values, e.g. "message.text".
+	// The "*" segment matches any field or array index, e.g. "message.items.*.caption".
+	RedactPaths []string
+	// MaxBodySize is the maximum logged body size in bytes. Larger bodies are not logged. Default is 64 KiB.
+	MaxBodySize int
+}
+
+// Dump is a middleware that logs request and response headers and bodies with LogLevelDebug,
+// e.g. to debug rejected SendMessage payloads. Secrets and personal data are redacted.
+//
+// Only JSON bodies are logged, with the values of RedactFields and RedactPaths replaced;
+// other bodies, e.g. multipart file uploads, are logged as their size and content type.
+// Bodies are restored after reading, so the request is sent and the response is returned intact.
+// If l is a StructuredLogger, the dump is logged with the attributes operation, method, path,
+// status, headers and body.
+func Dump(l Logger, s DumpSettings) Middleware {
+	r := newRedactor(s)
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			reqBody, err := peekRequestBody(req, r.maxBody)
+			if err != nil {
+				return nil, err
+			}
+
+			ctx := WithLogLevel(req.Context(), LogLevelDebug)
+			op := operationName(req)
+
+			logDump(ctx, l, "HTTP request dump", []slog.Attr{
+				slog.String("operation", op),
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.String("headers", r.dumpHeaders(req.Header)),
+				slog.String("body", r.dumpBody(reqBody, req.Header.Get("Content-Type"))),
+			})
+
+			resp, err := next.Do(req)
+			if err != nil || resp.Body == nil {
+				return resp, err
+			}
+
+			prefix, err := readLimited(resp.Body, r.maxBody)
+			if err != nil {
+				_ = resp.Body.Close()
+				return nil, err
+			}
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+
+			logDump(ctx, l, "HTTP response dump", []slog.Attr{
+				slog.String("operation", op),
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", resp.StatusCode),
+				slog.String("headers", r.dumpHeaders(resp.Header)),
+				slog.String("body", r.dumpBody(prefix, resp.Header.Get("Content-Type"))),
+			})
+
+			return resp, nil
+		})
+	}
+}
+
+// readLimited reads up to limit+1 bytes, so that the caller can tell whether the body exceeds the limit.
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(r, int64(limit)+1))
+}
+
+// peekRequestBody reads up to limit+1 bytes of the request body, see readLimited, leaving the body intact.
+// A body without GetBody is buffered only if it fits the limit; a larger one, e.g. a file upload,
+// is sent as the read prefix followed by the rest of the body.
+func peekRequestBody(req *http.Request, limit int) ([]byte, error) {
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = body.Close() }()
+
+		return readLimited(body, limit)
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	prefix, err := readLimited(req.Body, limit)
+	if err != nil {
+		_ = req.Body.Close()
+		return nil, err
+	}
+
+	if len(prefix) <= limit {
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(prefix))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(prefix)), nil
+		}
+		return prefix, nil
+	}
+
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), req.Body), req.Body}
+
+	return prefix, nil
+}
+
+// redactor formats headers and bodies for dumps.
+type redactor struct {
+	headers map[string]bool
+	fields  map[string]bool
+	paths   [][]string
+	maxBody int
+}
+
+// newRedactor creates a redactor from the settings, applying their defaults.
+func newRedactor(s DumpSettings) *redactor {
+	if s.RedactHeaders == nil {
+		s.RedactHeaders = DefaultRedactHeaders
+	}
+	if s.RedactFields == nil {
+		s.RedactFields = DefaultRedactFields
+	}
+	if s.MaxBodySize <= 0 {
+		s.MaxBodySize = 64 << 10
+	}
+
+	r := &redactor{
+		headers: make(map[string]bool, len(s.RedactHeaders)),
+		fields:  make(map[string]bool, len(s.RedactFields)),
+		maxBody: s.MaxBodySize,
+	}
+	for _, h := range s.RedactHeaders {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range s.RedactFields {
+		r.fields[f] = true
+	}
+	for _, p := range s.RedactPaths {
+		r.paths = append(r.paths, strings.Split(p, "."))
+	}
+
+	return r
+}
+
+// logDump logs the dump with attributes to a StructuredLogger, or as a multiline message to other loggers.
+func logDump(ctx context.Context, l Logger, msg string, attrs []slog.Attr) {
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.LogAttrs(ctx, LogLevelDebug, msg, attrs...)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, a := range attrs {
+		switch a.Key {
+		case "headers", "body":
+			if s := a.Value.String(); s != "" {
+				b.WriteString("\n")
+				b.WriteString(s)
+			}
+		default:
+			b.WriteString(" ")
+			b.WriteString(a.Value.String())
+		}
+	}
+
+	l.Log(ctx, "%s", b.String())
+}
+
+// redactHeaders returns a copy of h with the values of redacted headers replaced.
+func (r *redactor) redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for k, v := range out {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			out[k] = slices.Repeat([]string{redacted}, len(v))
+		}
+	}
+
+	return out
+}
+
+func (r *redactor) dumpHeaders(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range h[k] {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			if r.headers[http.CanonicalHeaderKey(k)] {
+				v = redacted
+			}
+			b.WriteString(k + ": " + v)
+		}
+	}
+
+	return b.String()
+}
+
+func (r *redactor) dumpBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > r.maxBody {
+		return fmt.Sprintf("<body larger than %d bytes>", r.maxBody)
+	}
+
+	describe := func() string {
+		if contentType == "" {
+			contentType = "unknown content type"
+		}
+		return "<" + strconv.Itoa(len(body)) + " bytes, " + contentType + ">"
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); contentType != "" && (err != nil || !strings.HasSuffix(mediaType, "json")) {
+		return describe()
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return describe()
+	}
+
+	out, err := json.Marshal(r.redact(v, nil))
+	if err != nil {
+		return describe()
+	}
+
+	return string(out)
+}
+
+func (r *redactor) redact(v any, path []string) any {
+	if r.matchPath(path) {
+		return redacted
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if r.fields[k] && child != nil {
+				v[k] = redacted
+				continue
+			}
+			v[k] = r.redact(child, append(slices.Clip(path), k))
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = r.redact(child, append(slices.Clip(path), strconv.Itoa(i)))
+		}
+	}
+
+	return v
+}
+
+func (r *redactor) matchPath(path []string) bool {
+	for _, p := range r.paths {
+		if len(p) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range p {
+			if p[i] != "*" && p[i] != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpMiddleware(t *testing.T) {
+	t.Parallel()
+
+	const sendBody = `{"channel": 1, "customer": {"external_id": "c1", "nickname": "john", "phone": "+79990000000", ` +
+		`"email": "john@example.com", "first_name": "John", "avatar": "http://example.com/a.png"}, ` +
+		`"message": {"type": "text", "text": "secret text", "items": [{"id": "f1", "caption": "cap"}]}}`
+
+	echoDoer := func(t *testing.T) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, sendBody, string(body), "request body is restored")
+
+			return &http.Response{
+				StatusCode: 400,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"errors": ["invalid phone +79990000000"]}`)),
+			}, nil
+		})
+	}
+
+	t.Run("bodies and headers are redacted", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		doer := Dump(NewDefaultLogger(log.New(&buf, "", 0)), DumpSettings{
+			RedactPaths: []string{"message.text", "message.items.*.caption"},
+		})(echoDoer(t))
+
+		req, _ := http.NewRequest("POST", "http://example.com/messages", strings.NewReader(sendBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(transportTokenHeader, "secret-token")
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+
+		parsed, err := ParseSendMessageResp(resp)
+		require.NoError(t, err)
+		require.Equal(t, []string{"invalid phone +79990000000"}, parsed.JSONDefault.Errors, "response body is restored")
+
+		logs := buf.String()
+		require.Contains(t, logs, "[DEBUG] HTTP request dump SendMessage POST /messages")
+		require.Contains(t, logs, "X-Transport-Token: [REDACTED]")
+		require.NotContains(t, logs, "secret-token")
+		for _, v := range []string{"john@example.com", "John", "a.png", "secret text", "cap\""} {
+			require.NotContains(t, logs, v)
+		}
+		require.Contains(t, logs, `"external_id":"c1"`)
+		require.Contains(t, logs, `"id":"f1"`)
+		require.Contains(t, logs, "[DEBUG] HTTP response dump SendMessage POST /messages 400")
+		require.Contains(t, logs, `{"errors":["invalid phone +79990000000"]}`)
+	})
+
+	t.Run("non-JSON and large bodies are not logged", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		doer := Dump(NewDefaultLogger(log.New(&buf, "", 0)), DumpSettings{MaxBodySize: 16})(DoerFunc(
+			func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				require.Equal(t, "file content", string(body))
+
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"id": "0123456789abcdef"}`)),
+				}, nil
+			},
+		))
+
+		req, _ := http.NewRequest("POST", "http://example.com/files/upload", strings.NewReader("file content"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, `{"id": "0123456789abcdef"}`, readBody(t, resp))
+
+		logs := buf.String()
+		require.Contains(t, logs, "<12 bytes, multipart/form-data; boundary=x>")
+		require.NotContains(t, logs, "file content")
+		require.Contains(t, logs, "<body larger than 16 bytes>")
+	})
+
+	t.Run("large bodies are not buffered", func(t *testing.T) {
+		t.Parallel()
+
+		content := strings.Repeat("x", 1000)
+
+		var buf bytes.Buffer
+		doer := Dump(NewDefaultLogger(log.New(&buf, "", 0)), DumpSettings{MaxBodySize: 16})(DoerFunc(
+			func(req *http.Request) (*http.Response, error) {
+				require.Nil(t, req.GetBody)
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				require.Equal(t, content, string(body), "request body is restored")
+				require.NoError(t, req.Body.Close())
+
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			},
+		))
+
+		req, _ := http.NewRequest("POST", "http://example.com/files/upload", io.NopCloser(strings.NewReader(content)))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "<body larger than 16 bytes>")
+	})
+}
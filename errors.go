@@ -0,0 +1,153 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const maxBodySnippetLen = 256
+
+var (
+	// ErrUnauthorized is matched by an APIError with 401 or 403 status code.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is matched by an APIError with 404 status code.
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is matched by an APIError with 429 status code.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrValidation is matched by an APIError with 400 or 422 status code.
+	ErrValidation = errors.New("validation failed")
+)
+
+// APIError describes an error response returned by the Message Gateway.
+// Use errors.Is with ErrUnauthorized, ErrNotFound, ErrRateLimited or ErrValidation
+// to check the error kind, or errors.As to access the details.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Operation is the name of the API operation, e.g. "SendMessage".
+	Operation string
+	// Method and Path describe the request, if it is known.
+	Method string
+	Path   string
+	// Errors contains all the error strings from ErrorResponse.
+	Errors []string
+	// Body is the raw response body.
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Operation)
+	if e.Method != "" {
+		fmt.Fprintf(&sb, " (%s %s)", e.Method, e.Path)
+	}
+	fmt.Fprintf(&sb, ": status %d", e.StatusCode)
+
+	switch {
+	case len(e.Errors) > 0:
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(e.Errors, "; "))
+	case len(e.Body) == 0:
+		sb.WriteString(": empty response body")
+	default:
+		sb.WriteString(": unexpected response body: ")
+		sb.WriteString(bodySnippet(e.Body))
+	}
+
+	return sb.String()
+}
+
+// Is reports whether the error matches one of the sentinel errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	default:
+		return false
+	}
+}
+
+// newAPIError builds an APIError from the parsed error response of the given operation.
+// A 2xx response without error strings is not an error: the generated parsers decode
+// any JSON body of an unlisted 2xx status as ErrorResponse.
+func newAPIError(operation string, rsp *http.Response, body []byte, errResp *ErrorResponse) error {
+	if errResp != nil && len(errResp.Errors) == 0 && rsp != nil && isSuccessStatus(rsp.StatusCode) {
+		return nil
+	}
+
+	e := &APIError{
+		Operation: operation,
+		Body:      body,
+	}
+
+	if rsp != nil {
+		e.StatusCode = rsp.StatusCode
+		if rsp.Request != nil {
+			e.Method = rsp.Request.Method
+			e.Path = rsp.Request.URL.Path
+		}
+	}
+
+	if errResp != nil {
+		e.Errors = errResp.Errors
+	}
+
+	return e
+}
+
+// unexpectedResponseError returns an APIError if the response has a non-2xx status
+// or has no JSON body. It is used in addition to the checks of ErrorResponse.
+func unexpectedResponseError(operation string, rsp *http.Response, body []byte) error {
+	if rsp != nil && isSuccessStatus(rsp.StatusCode) && strings.Contains(rsp.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+
+	return newAPIError(operation, rsp, body, nil)
+}
+
+func isSuccessStatus(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// bodySnippet returns the body truncated to maxBodySnippetLen bytes.
+func bodySnippet(body []byte) string {
+	if len(body) <= maxBodySnippetLen {
+		return string(body)
+	}
+
+	return string(body[:maxBodySnippetLen]) + "..."
+}
+
+// responseErrors returns the errors of the ErrorResponse body. The body is buffered
+// and replaced, so it is left intact.
+func responseErrors(resp *http.Response) []string {
+	if resp.Body == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		return nil
+	}
+
+	return errResp.Errors
+}
@@ -0,0 +1,180 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func errorDoer(status int, body string) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Request:    req,
+		}, nil
+	})
+}
+
+func TestAPIError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("error response is returned as APIError", func(t *testing.T) {
+		t.Parallel()
+
+		body := `{"errors": ["channel not found", "another error"]}`
+		client, err := NewClientWithResponses("https://example.com", WithHTTPClient(errorDoer(404, body)))
+		require.NoError(t, err)
+
+		err = ExtractError(client.DeactivateChannelWithResponse(context.Background(), 10))
+		require.Error(t, err)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.NotErrorIs(t, err, ErrValidation)
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, 404, apiErr.StatusCode)
+		require.Equal(t, "DeactivateChannel", apiErr.Operation)
+		require.Equal(t, "DELETE", apiErr.Method)
+		require.Equal(t, "/channels/10", apiErr.Path)
+		require.Equal(t, []string{"channel not found", "another error"}, apiErr.Errors)
+		require.Equal(t, body, string(apiErr.Body))
+		require.Equal(
+			t,
+			"DeactivateChannel (DELETE /channels/10): status 404: channel not found; another error",
+			apiErr.Error(),
+		)
+	})
+
+	t.Run("empty errors list does not panic", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := NewClientWithResponses("https://example.com", WithHTTPClient(errorDoer(500, `{}`)))
+		require.NoError(t, err)
+
+		err = ExtractError(client.GetTemplatesWithResponse(context.Background()))
+		require.EqualError(t, err, "GetTemplates (GET /templates): status 500: unexpected response body: {}")
+	})
+
+	t.Run("sentinel errors by status code", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			status   int
+			sentinel error
+		}{
+			{http.StatusUnauthorized, ErrUnauthorized},
+			{http.StatusForbidden, ErrUnauthorized},
+			{http.StatusNotFound, ErrNotFound},
+			{http.StatusTooManyRequests, ErrRateLimited},
+			{http.StatusBadRequest, ErrValidation},
+			{http.StatusUnprocessableEntity, ErrValidation},
+		}
+
+		for _, tc := range testCases {
+			err := error(&APIError{StatusCode: tc.status})
+			require.ErrorIs(t, err, tc.sentinel, "status %d", tc.status)
+		}
+
+		require.False(t, errors.Is(&APIError{StatusCode: 500}, ErrValidation))
+	})
+
+	t.Run("transport error takes precedence", func(t *testing.T) {
+		t.Parallel()
+
+		expectedErr := errors.New("connection refused")
+		require.ErrorIs(t, ExtractError((*SendMessageResp)(nil), expectedErr), expectedErr)
+	})
+}
+
+func TestStrictError(t *testing.T) {
+	t.Parallel()
+
+	htmlDoer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusBadGateway,
+			Body:       io.NopCloser(strings.NewReader("<html>" + strings.Repeat("a", 500) + "</html>")),
+			Header:     http.Header{"Content-Type": []string{"text/html"}},
+			Request:    req,
+		}, nil
+	})
+
+	t.Run("non-JSON error status is ignored by ExtractError", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := NewClientWithResponses("https://example.com", WithHTTPClient(htmlDoer))
+		require.NoError(t, err)
+
+		require.NoError(t, ExtractError(client.AckMessageWithResponse(context.Background(), AckMessageJSONRequestBody{})))
+	})
+
+	t.Run("non-JSON error status is an error in strict mode", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := NewClientWithResponses("https://example.com", WithHTTPClient(htmlDoer))
+		require.NoError(t, err)
+
+		err = ExtractStrictError(client.AckMessageWithResponse(context.Background(), AckMessageJSONRequestBody{}))
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+		require.Equal(t, "AckMessage", apiErr.Operation)
+		require.Contains(t, err.Error(), "AckMessage (POST /messages/ack): status 502: unexpected response body: <html>aaa")
+		require.True(t, strings.HasSuffix(err.Error(), "..."))
+		require.Less(t, len(err.Error()), 400)
+	})
+
+	t.Run("empty 2xx body is an error in strict mode", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := NewClientWithResponses("https://example.com", WithHTTPClient(fakeDoer(200, nil)))
+		require.NoError(t, err)
+
+		err = ExtractStrictError(client.GetFileUrlWithResponse(context.Background(), "uuid"))
+		require.EqualError(t, err, "GetFileUrl: status 200: empty response body")
+	})
+
+	t.Run("JSON responses", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			name      string
+			status    int
+			body      string
+			expectErr bool
+		}{
+			{"200 with payload", 200, `{"message_id": 1, "time": "2024-12-31T00:00:00Z"}`, false},
+			{"unlisted 2xx status", 201, `{"message_id": 1, "time": "2024-12-31T00:00:00Z"}`, false},
+			{"error response", 400, `{"errors": ["invalid channel"]}`, true},
+			{"error status without errors", 500, `{}`, true},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				client, err := NewClientWithResponses("https://example.com", WithHTTPClient(errorDoer(tc.status, tc.body)))
+				require.NoError(t, err)
+
+				resp, err := client.SendMessageWithResponse(context.Background(), SendMessageJSONRequestBody{})
+				require.NoError(t, err)
+
+				if tc.expectErr {
+					require.Error(t, ExtractError(resp, nil))
+					require.Error(t, ExtractStrictError(resp, nil))
+				} else {
+					require.NoError(t, ExtractError(resp, nil))
+					require.NoError(t, ExtractStrictError(resp, nil))
+				}
+			})
+		}
+	})
+}
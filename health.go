@@ -0,0 +1,158 @@
+package transport_api_client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HealthStatus is the outcome of a health check.
+type HealthStatus string
+
+const (
+	// HealthOK means that the base URL and the token work.
+	HealthOK HealthStatus = "ok"
+	// HealthBadToken means that the Message Gateway rejected the token with 401 or 403.
+	HealthBadToken HealthStatus = "bad_token"
+	// HealthWrongURL means that the base URL does not point to the MG Transport API:
+	// the path is not found, or the response is not JSON.
+	HealthWrongURL HealthStatus = "wrong_url"
+	// HealthTLSError means that the TLS handshake or the certificate verification failed.
+	HealthTLSError HealthStatus = "tls_error"
+	// HealthDNSError means that the host of the base URL could not be resolved.
+	HealthDNSError HealthStatus = "dns_error"
+	// HealthUnavailable means that the Message Gateway can't be reached in time or responds with 429 or 5xx.
+	HealthUnavailable HealthStatus = "unavailable"
+	// HealthError means any other error.
+	HealthError HealthStatus = "error"
+)
+
+// HealthResult is the result of CheckHealth. It is an http.Handler that responds with the result
+// as JSON, with 200 status code if the check passed and 503 otherwise.
+type HealthResult struct {
+	Status HealthStatus
+	// Latency is the duration of the check call.
+	Latency time.Duration
+	// ServerTime is the Date header of the response, or zero if there was none.
+	ServerTime time.Time
+	// ServerTimeOffset is ServerTime minus the local time in the middle of the call.
+	// The Date header has a resolution of one second, so the offset is accurate to about a second.
+	ServerTimeOffset time.Duration
+	// Err is the error of failed checks.
+	Err error
+}
+
+// OK reports whether the check passed.
+func (r HealthResult) OK() bool { return r.Status == HealthOK }
+
+func (r HealthResult) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	body := struct {
+		Status             HealthStatus `json:"status"`
+		LatencyMs          float64      `json:"latency_ms"`
+		ServerTimeOffsetMs *float64     `json:"server_time_offset_ms,omitempty"`
+		Error              string       `json:"error,omitempty"`
+	}{
+		Status:    r.Status,
+		LatencyMs: milliseconds(r.Latency),
+	}
+	if !r.ServerTime.IsZero() {
+		offset := milliseconds(r.ServerTimeOffset)
+		body.ServerTimeOffsetMs = &offset
+	}
+	if r.Err != nil {
+		body.Error = r.Err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.OK() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// Verify checks that the base URL and the token of the client work, see CheckHealth.
+func (c *Client) Verify(ctx context.Context) HealthResult {
+	return CheckHealth(ctx, c)
+}
+
+// CheckHealth makes a cheap authenticated call, ListChannels with limit 1, and classifies its outcome,
+// e.g. to check the configuration at startup or in readiness probes. The call bypasses the Cache middleware.
+func CheckHealth(ctx context.Context, c ClientInterface) HealthResult {
+	ctx = WithoutCache(ctx)
+	limit := LimitQuery(1)
+	start := time.Now()
+
+	resp, err := c.ListChannels(ctx, &ListChannelsParams{Limit: &limit})
+	if err != nil {
+		return HealthResult{Status: classifyHealthError(err), Latency: time.Since(start), Err: err}
+	}
+
+	parsed, err := ParseListChannelsResp(resp)
+
+	r := HealthResult{Latency: time.Since(start), Err: err}
+	if err == nil {
+		r.Err = parsed.StrictError()
+	}
+	if serverTime, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		r.ServerTime = serverTime
+		r.ServerTimeOffset = serverTime.Sub(start.Add(r.Latency / 2))
+	}
+
+	switch code := resp.StatusCode; {
+	case r.Err == nil:
+		r.Status = HealthOK
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		r.Status = HealthBadToken
+	case code == http.StatusTooManyRequests || code >= http.StatusInternalServerError:
+		r.Status = HealthUnavailable
+	case code == http.StatusNotFound || code == http.StatusMethodNotAllowed || isSuccessStatus(code):
+		// a 2xx response without the channels JSON is e.g. an HTML page of a wrong host
+		r.Status = HealthWrongURL
+	default:
+		r.Status = HealthError
+	}
+
+	return r
+}
+
+// HealthHandler returns an http.Handler for readiness probes that runs CheckHealth
+// with the context of each probe request and responds with the HealthResult.
+func HealthHandler(c ClientInterface) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		CheckHealth(r.Context(), c).ServeHTTP(w, r)
+	})
+}
+
+func classifyHealthError(err error) HealthStatus {
+	var (
+		dnsErr          *net.DNSError
+		certErr         *tls.CertificateVerificationError
+		unknownAuthErr  x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		certInvalidErr  x509.CertificateInvalidError
+		recordHeaderErr tls.RecordHeaderError
+		alertErr        tls.AlertError
+		opErr           *net.OpError
+		netErr          net.Error
+	)
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return HealthDNSError
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr),
+		errors.As(err, &certInvalidErr), errors.As(err, &recordHeaderErr), errors.As(err, &alertErr):
+		return HealthTLSError
+	case isContextError(err), errors.As(err, &opErr), errors.As(err, &netErr) && netErr.Timeout(),
+		errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrBulkheadFull), errors.Is(err, ErrRequestTimeout):
+		return HealthUnavailable
+	default:
+		return HealthError
+	}
+}
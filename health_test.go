@@ -0,0 +1,194 @@
+package transport_api_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHealth(t *testing.T) {
+	t.Parallel()
+
+	t.Run("responses are classified", func(t *testing.T) {
+		t.Parallel()
+
+		for name, tc := range map[string]struct {
+			handler http.HandlerFunc
+			status  HealthStatus
+		}{
+			"ok": {
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					require.Equal(t, "1", r.URL.Query().Get("limit"))
+					require.Equal(t, "token", r.Header.Get(transportTokenHeader))
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`[]`))
+				},
+				status: HealthOK,
+			},
+			"bad token": {
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusUnauthorized)
+					_, _ = w.Write([]byte(`{"errors": ["invalid token"]}`))
+				},
+				status: HealthBadToken,
+			},
+			"wrong path": {
+				handler: http.NotFound,
+				status:  HealthWrongURL,
+			},
+			"wrong host": {
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/html")
+					_, _ = w.Write([]byte(`<html></html>`))
+				},
+				status: HealthWrongURL,
+			},
+			"unavailable": {
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusBadGateway)
+				},
+				status: HealthUnavailable,
+			},
+		} {
+			srv := httptest.NewServer(tc.handler)
+			t.Cleanup(srv.Close)
+
+			c, err := NewClient(srv.URL, WithTransportToken("token"))
+			require.NoError(t, err)
+
+			result := c.Verify(context.Background())
+			require.Equal(t, tc.status, result.Status, name)
+			require.Equal(t, tc.status == HealthOK, result.Err == nil, name)
+			require.Greater(t, result.Latency, time.Duration(0), name)
+		}
+	})
+
+	t.Run("server time offset is measured", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		t.Cleanup(srv.Close)
+
+		c, err := NewClient(srv.URL)
+		require.NoError(t, err)
+
+		result := c.Verify(context.Background())
+		require.True(t, result.OK())
+		require.InDelta(t, -time.Hour, result.ServerTimeOffset, float64(2*time.Second))
+	})
+
+	t.Run("responses are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		var healthy atomic.Bool
+		healthy.Store(true)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		t.Cleanup(srv.Close)
+
+		c, err := NewClient(srv.URL, WithMiddlewares(Cache(CacheSettings{})))
+		require.NoError(t, err)
+
+		require.True(t, c.Verify(context.Background()).OK())
+
+		healthy.Store(false)
+		require.Equal(t, HealthUnavailable, c.Verify(context.Background()).Status)
+	})
+
+	t.Run("TLS errors are classified", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		c, err := NewClient(srv.URL)
+		require.NoError(t, err)
+
+		require.Equal(t, HealthTLSError, c.Verify(context.Background()).Status)
+	})
+
+	t.Run("transport errors are classified", func(t *testing.T) {
+		t.Parallel()
+
+		for err, status := range map[error]HealthStatus{
+			&net.DNSError{Err: "no such host", Name: "mg.invalid", IsNotFound: true}:    HealthDNSError,
+			&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}: HealthUnavailable,
+			context.DeadlineExceeded: HealthUnavailable,
+			ErrCircuitOpen:           HealthUnavailable,
+			errors.New("unexpected"): HealthError,
+		} {
+			c, cerr := NewClient("http://mg.invalid", WithHTTPClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, &url.Error{Op: "Get", URL: req.URL.String(), Err: err}
+			})))
+			require.NoError(t, cerr)
+
+			result := c.Verify(context.Background())
+			require.Equal(t, status, result.Status, err.Error())
+			require.ErrorIs(t, result.Err, err)
+		}
+	})
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(srv.URL)
+	require.NoError(t, err)
+
+	probe := func() (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		HealthHandler(c).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	code, body := probe()
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", body["status"])
+	require.Contains(t, body, "latency_ms")
+	require.Contains(t, body, "server_time_offset_ms")
+
+	healthy.Store(false)
+	code, body = probe()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "bad_token", body["status"])
+	require.NotEmpty(t, body["error"])
+}
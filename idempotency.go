@@ -0,0 +1,388 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord is a remembered result of a successful SendMessage call.
+type IdempotencyRecord struct {
+	MessageID int64     `json:"message_id"`
+	Time      time.Time `json:"time"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IdempotencyStore keeps results of successful SendMessage calls.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	Get(key string) (IdempotencyRecord, bool, error)
+	Set(key string, record IdempotencyRecord) error
+}
+
+// IdempotencySettings configures the Idempotency middleware.
+type IdempotencySettings struct {
+	// Store keeps the results. Default is an in-memory store.
+	Store IdempotencyStore
+	// Window is the time a result is remembered. Default is 24h.
+	Window time.Duration
+	// OnStoreError is called when the Store fails to save a result. The response is
+	// returned anyway, since the message has already been sent, but a repeated call
+	// with the same key will not be deduplicated.
+	OnStoreError func(key string, err error)
+}
+
+// IdempotencyReplayHeader is set to "true" on responses returned from the IdempotencyStore.
+const IdempotencyReplayHeader = "X-Idempotency-Replay"
+
+// Idempotency is a middleware that prevents duplicate SendMessage calls.
+// Calls are keyed by the transport token, channel and message.external_id;
+// calls without external_id are passed as is.
+//
+// A successful result is remembered for Window, and repeated calls with the same key get
+// a 200 response with the remembered message_id without sending the request.
+// Concurrent calls with the same key are serialized. Place Idempotency before Retry,
+// so that retries of a call are made while holding its key.
+func Idempotency(s IdempotencySettings) Middleware {
+	if s.Store == nil {
+		s.Store = NewMemoryIdempotencyStore()
+	}
+	if s.Window <= 0 {
+		s.Window = 24 * time.Hour
+	}
+
+	var locks keyedMutex
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if op, ok := requestOperation(req); !ok || op.ID != "SendMessage" {
+				return next.Do(req)
+			}
+
+			if err := ensureGetBody(req); err != nil {
+				return nil, err
+			}
+
+			key, ok := idempotencyKey(req)
+			if !ok {
+				return next.Do(req)
+			}
+
+			unlock := locks.lock(key)
+			defer unlock()
+
+			record, found, err := s.Store.Get(key)
+			if err != nil {
+				return nil, err
+			}
+			if found && time.Now().Before(record.ExpiresAt) {
+				return record.response(req)
+			}
+
+			resp, err := next.Do(req)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				return resp, err
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+
+			var sent SendMessageResponse
+			if err := json.Unmarshal(body, &sent); err == nil && sent.MessageID > 0 {
+				err = s.Store.Set(key, IdempotencyRecord{
+					MessageID: sent.MessageID,
+					Time:      sent.Time,
+					ExpiresAt: time.Now().Add(s.Window),
+				})
+				if err != nil && s.OnStoreError != nil {
+					s.OnStoreError(key, err)
+				}
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+func (r IdempotencyRecord) response(req *http.Request) (*http.Response, error) {
+	body, err := json.Marshal(SendMessageResponse{MessageID: r.MessageID, Time: r.Time})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":          []string{"application/json"},
+			IdempotencyReplayHeader: []string{"true"},
+		},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// idempotencyKey returns the key of a SendMessage request with message.external_id.
+func idempotencyKey(req *http.Request) (string, bool) {
+	body, err := req.GetBody()
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = body.Close() }()
+
+	var msg struct {
+		Channel int64 `json:"channel"`
+		Message struct {
+			ExternalID *string `json:"external_id"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(body).Decode(&msg); err != nil {
+		return "", false
+	}
+	if msg.Message.ExternalID == nil || *msg.Message.ExternalID == "" {
+		return "", false
+	}
+
+	token := sha256.Sum256([]byte(req.Header.Get(transportTokenHeader)))
+
+	return hex.EncodeToString(token[:8]) + ":" + strconv.FormatInt(msg.Channel, 10) + ":" + *msg.Message.ExternalID, true
+}
+
+// keyedMutex serializes calls with the same key.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedMutexEntry
+}
+
+type keyedMutexEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (m *keyedMutex) lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyedMutexEntry)
+	}
+	e, ok := m.locks[key]
+	if !ok {
+		e = &keyedMutexEntry{}
+		m.locks[key] = e
+	}
+	e.refs++
+	m.mu.Unlock()
+
+	e.mu.Lock()
+
+	return func() {
+		e.mu.Unlock()
+
+		m.mu.Lock()
+		e.refs--
+		if e.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// idempotencyPruneInterval is the minimum time between scans for expired records.
+const idempotencyPruneInterval = time.Minute
+
+// expiringRecords are records that are removed once they expire: on lookup, or by a scan
+// made at most once per idempotencyPruneInterval, so that writes don't scan all records.
+type expiringRecords struct {
+	records   map[string]IdempotencyRecord
+	nextPrune time.Time
+}
+
+func (r *expiringRecords) get(key string, now time.Time) (IdempotencyRecord, bool) {
+	record, ok := r.records[key]
+	if ok && !now.Before(record.ExpiresAt) {
+		delete(r.records, key)
+		return IdempotencyRecord{}, false
+	}
+
+	return record, ok
+}
+
+// prune removes the expired records, if the last scan was made long enough ago,
+// and reports whether it did.
+func (r *expiringRecords) prune(now time.Time) bool {
+	if now.Before(r.nextPrune) {
+		return false
+	}
+	r.nextPrune = now.Add(idempotencyPruneInterval)
+
+	for k, record := range r.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(r.records, k)
+		}
+	}
+
+	return true
+}
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records expiringRecords
+}
+
+// NewMemoryIdempotencyStore creates an in-memory IdempotencyStore.
+// Expired records are removed on lookups and periodically on writes.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: expiringRecords{records: make(map[string]IdempotencyRecord)}}
+}
+
+func (s *memoryIdempotencyStore) Get(key string) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records.get(key, time.Now())
+	return r, ok, nil
+}
+
+func (s *memoryIdempotencyStore) Set(key string, record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records.prune(time.Now())
+	s.records.records[key] = record
+
+	return nil
+}
+
+// fileIdempotencyLine is a line of the file of fileIdempotencyStore.
+type fileIdempotencyLine struct {
+	Key    string            `json:"key"`
+	Record IdempotencyRecord `json:"record"`
+}
+
+type fileIdempotencyStore struct {
+	mu      sync.Mutex
+	path    string
+	records expiringRecords
+	// lines is the number of lines in the file, including expired and overwritten records
+	lines int
+}
+
+// NewFileIdempotencyStore creates an IdempotencyStore persisted in a JSON Lines file,
+// so that the results survive restarts. The file is created if it does not exist.
+// Writes append a line, and the file is compacted when expired and overwritten records
+// make up most of it.
+func NewFileIdempotencyStore(path string) (IdempotencyStore, error) {
+	s := &fileIdempotencyStore{
+		path:    path,
+		records: expiringRecords{records: make(map[string]IdempotencyRecord)},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		s.lines++
+
+		// a line cut short by a crash is skipped
+		var l fileIdempotencyLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			continue
+		}
+		s.records.records[l.Key] = l.Record
+	}
+	s.records.prune(time.Now())
+
+	return s, nil
+}
+
+func (s *fileIdempotencyStore) Get(key string) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records.get(key, time.Now())
+	return r, ok, nil
+}
+
+func (s *fileIdempotencyStore) Set(key string, record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records.prune(time.Now())
+	s.records.records[key] = record
+
+	if s.lines >= 2*len(s.records.records)+100 {
+		return s.compact()
+	}
+
+	line, err := json.Marshal(fileIdempotencyLine{Key: key, Record: record})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.lines++
+
+	return f.Close()
+}
+
+// compact rewrites the file with the current records. The caller must hold s.mu.
+func (s *fileIdempotencyStore) compact() error {
+	var buf bytes.Buffer
+	for key, record := range s.records.records {
+		line, err := json.Marshal(fileIdempotencyLine{Key: key, Record: record})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	// write to a temporary file first, so that the file is never left half-written
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.lines = len(s.records.records)
+
+	return nil
+}
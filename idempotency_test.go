@@ -0,0 +1,275 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sendMessageDoer(calls *atomic.Int32) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		n := calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body: io.NopCloser(strings.NewReader(
+				`{"message_id": ` + strconv.Itoa(int(n)) + `, "time": "2024-01-02T03:04:05Z"}`,
+			)),
+		}, nil
+	})
+}
+
+func newSendMessageRequest(channel int, externalID string) *http.Request {
+	body := `{"channel": ` + strconv.Itoa(channel) + `, "message": {"external_id": "` + externalID + `", "type": "text"}}`
+	req, _ := http.NewRequest("POST", "http://example.com/messages", bytes.NewReader([]byte(body)))
+	req.Header.Set(transportTokenHeader, "token")
+	return req
+}
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+type failingIdempotencyStore struct{}
+
+func (failingIdempotencyStore) Get(string) (IdempotencyRecord, bool, error) {
+	return IdempotencyRecord{}, false, nil
+}
+
+func (failingIdempotencyStore) Set(string, IdempotencyRecord) error {
+	return errStoreUnavailable
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("duplicate send returns remembered message id", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Idempotency(IdempotencySettings{})(sendMessageDoer(&calls))
+
+		for i := 0; i < 3; i++ {
+			resp, err := doer.Do(newSendMessageRequest(1, "ext-1"))
+			require.NoError(t, err)
+
+			parsed, err := ParseSendMessageResp(resp)
+			require.NoError(t, err)
+			require.NotNil(t, parsed.JSON200)
+			require.Equal(t, int64(1), parsed.JSON200.MessageID)
+			require.Equal(t, i > 0, resp.Header.Get(IdempotencyReplayHeader) == "true")
+		}
+
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("keys include channel and external id", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Idempotency(IdempotencySettings{})(sendMessageDoer(&calls))
+
+		for _, req := range []*http.Request{
+			newSendMessageRequest(1, "ext-1"),
+			newSendMessageRequest(2, "ext-1"),
+			newSendMessageRequest(1, "ext-2"),
+		} {
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("sends without external id are not deduplicated", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Idempotency(IdempotencySettings{})(sendMessageDoer(&calls))
+
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("POST", "http://example.com/messages", strings.NewReader(`{"channel": 1, "message": {}}`))
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("concurrent sends are serialized", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Idempotency(IdempotencySettings{})(sendMessageDoer(&calls))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := doer.Do(newSendMessageRequest(1, "ext-1"))
+				require.NoError(t, err)
+				parsed, err := ParseSendMessageResp(resp)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), parsed.JSON200.MessageID)
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("failed sends are not remembered", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Idempotency(IdempotencySettings{})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			return &http.Response{StatusCode: 500, Body: io.NopCloser(strings.NewReader(`{"errors": ["boom"]}`))}, nil
+		}))
+
+		for i := 0; i < 2; i++ {
+			resp, err := doer.Do(newSendMessageRequest(1, "ext-1"))
+			require.NoError(t, err)
+			require.Equal(t, 500, resp.StatusCode)
+		}
+
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("store errors do not lose the response", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			calls    atomic.Int32
+			storeErr error
+		)
+		doer := Idempotency(IdempotencySettings{
+			Store:        failingIdempotencyStore{},
+			OnStoreError: func(key string, err error) { storeErr = err },
+		})(sendMessageDoer(&calls))
+
+		resp, err := doer.Do(newSendMessageRequest(1, "ext-1"))
+		require.NoError(t, err)
+		require.ErrorIs(t, storeErr, errStoreUnavailable)
+
+		parsed, err := ParseSendMessageResp(resp)
+		require.NoError(t, err)
+		require.NotNil(t, parsed.JSON200)
+		require.Equal(t, int64(1), parsed.JSON200.MessageID)
+	})
+
+	t.Run("records expire after window", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Idempotency(IdempotencySettings{Window: 20 * time.Millisecond})(sendMessageDoer(&calls))
+
+		_, err := doer.Do(newSendMessageRequest(1, "ext-1"))
+		require.NoError(t, err)
+		time.Sleep(30 * time.Millisecond)
+		_, err = doer.Do(newSendMessageRequest(1, "ext-1"))
+		require.NoError(t, err)
+
+		require.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+
+	store, err := NewFileIdempotencyStore(path)
+	require.NoError(t, err)
+
+	rec := IdempotencyRecord{MessageID: 42, Time: time.Now().UTC().Truncate(time.Second), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, store.Set("key", rec))
+	require.NoError(t, store.Set("expired", IdempotencyRecord{MessageID: 1, ExpiresAt: time.Now().Add(-time.Second)}))
+
+	reopened, err := NewFileIdempotencyStore(path)
+	require.NoError(t, err)
+
+	got, ok, err := reopened.Get("key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, rec.MessageID, got.MessageID)
+	require.True(t, rec.Time.Equal(got.Time))
+
+	_, ok, err = reopened.Get("expired")
+	require.NoError(t, err)
+	require.False(t, ok, "expired records are not loaded")
+
+	t.Run("writes are appended and compacted", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+		store, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+
+		for i := range 500 {
+			require.NoError(t, store.Set("key", IdempotencyRecord{MessageID: int64(i), ExpiresAt: time.Now().Add(time.Hour)}))
+		}
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.LessOrEqual(t, bytes.Count(data, []byte("\n")), 102)
+
+		reopened, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		got, ok, err := reopened.Get("key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, int64(499), got.MessageID)
+	})
+
+	t.Run("line cut short by a crash is skipped", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+		store, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		require.NoError(t, store.Set("key", IdempotencyRecord{MessageID: 1, ExpiresAt: time.Now().Add(time.Hour)}))
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"key": "other", "rec`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		reopened, err := NewFileIdempotencyStore(path)
+		require.NoError(t, err)
+		_, ok, err := reopened.Get("key")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryIdempotencyStore().(*memoryIdempotencyStore)
+	require.NoError(t, store.Set("expired", IdempotencyRecord{MessageID: 1, ExpiresAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, store.Set("other", IdempotencyRecord{MessageID: 2, ExpiresAt: time.Now().Add(-time.Second)}))
+	require.Len(t, store.records.records, 2, "writes scan for expired records at most once per interval")
+
+	_, ok, err := store.Get("expired")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Len(t, store.records.records, 1, "expired records are removed on lookup")
+
+	store.records.nextPrune = time.Time{}
+	require.NoError(t, store.Set("key", IdempotencyRecord{MessageID: 3, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.Len(t, store.records.records, 1)
+}
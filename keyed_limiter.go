@@ -0,0 +1,96 @@
+package transport_api_client
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// KeyedRate is a token bucket configuration of a KeyedLimiter.
+type KeyedRate struct {
+	// Rate is the number of requests per second.
+	Rate float64
+	// Burst is the maximum burst size.
+	Burst int
+}
+
+// KeyedLimiterSettings configures the KeyedLimiter middleware.
+type KeyedLimiterSettings struct {
+	// Default is the rate of channels without a rate in Rates. Default is 10 rps with burst 10.
+	Default KeyedRate
+	// Rates configures rates per channel type, e.g. a lower rate for WhatsApp channels.
+	Rates map[ChannelType]KeyedRate
+	// ChannelType resolves the type of the channel, e.g. from a cached ListChannels result.
+	// If it is nil or returns false, the Default rate is used.
+	ChannelType func(channelID int64) (ChannelType, bool)
+	// Global is applied to all requests after the per-channel limiter. Optional.
+	Global RateLimiter
+	// MaxKeys is the number of per-channel limiters kept in memory. Default is 10000.
+	MaxKeys int
+}
+
+// KeyedLimiter is a middleware that applies a separate token bucket to each channel.
+// The channel ID is taken from the /channels/{channel_id} path or from the channel
+// and channel_id fields of the JSON request body. Requests without a channel
+// are limited by the Global limiter only.
+//
+// The least recently used per-channel limiters are evicted when MaxKeys is exceeded.
+func KeyedLimiter(s KeyedLimiterSettings) Middleware {
+	if s.Default.Rate <= 0 {
+		s.Default.Rate = 10
+	}
+	if s.Default.Burst <= 0 {
+		s.Default.Burst = max(int(s.Default.Rate), 1)
+	}
+	if s.MaxKeys <= 0 {
+		s.MaxKeys = 10000
+	}
+
+	limiters := newLRU[int64, RateLimiter](s.MaxKeys)
+	newLimiter := func(channelID int64) RateLimiter {
+		r := s.Default
+		if s.ChannelType != nil {
+			if t, ok := s.ChannelType(channelID); ok {
+				if typed, ok := s.Rates[t]; ok {
+					r = typed
+				}
+			}
+		}
+
+		return defaultLimiter{Limiter: rate.NewLimiter(rate.Limit(r.Rate), r.Burst)}
+	}
+
+	waitKeyed := func(req *http.Request) error {
+		if op, ok := requestOperation(req); ok && op.ChannelID != 0 {
+			channelID := op.ChannelID
+			lim := limiters.getOrAdd(channelID, func() RateLimiter { return newLimiter(channelID) })
+			if err := lim.Wait(req.Context()); err != nil {
+				return err
+			}
+		}
+
+		if s.Global != nil {
+			return s.Global.Wait(req.Context())
+		}
+
+		return nil
+	}
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := bufferJSONBody(req); err != nil {
+				return nil, err
+			}
+
+			start := time.Now()
+			err := waitKeyed(req)
+			addLimiterWait(req.Context(), time.Since(start))
+			if err != nil {
+				return nil, err
+			}
+
+			return next.Do(req)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package transport_api_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingLimiter struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	return nil
+}
+
+func TestKeyedLimiterMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("channels are limited separately", func(t *testing.T) {
+		t.Parallel()
+
+		global := &countingLimiter{}
+		doer := KeyedLimiter(KeyedLimiterSettings{
+			Default: KeyedRate{Rate: 2, Burst: 1},
+			Global:  global,
+		})(fakeDoer(200, nil))
+
+		send := func(channelID string) time.Duration {
+			req, _ := http.NewRequest("POST", "http://example.com/messages",
+				strings.NewReader(`{"channel": `+channelID+`}`))
+
+			start := time.Now()
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+			return time.Since(start)
+		}
+
+		require.Less(t, send("1"), 50*time.Millisecond)
+		require.Less(t, send("2"), 50*time.Millisecond)
+		require.GreaterOrEqual(t, send("1"), 400*time.Millisecond)
+
+		global.mu.Lock()
+		defer global.mu.Unlock()
+		require.Equal(t, 3, global.calls)
+	})
+
+	t.Run("rate is chosen by channel type", func(t *testing.T) {
+		t.Parallel()
+
+		doer := KeyedLimiter(KeyedLimiterSettings{
+			Default: KeyedRate{Rate: 100, Burst: 100},
+			Rates: map[ChannelType]KeyedRate{
+				ChannelTypeWhatsapp: {Rate: 2, Burst: 1},
+			},
+			ChannelType: func(channelID int64) (ChannelType, bool) {
+				if channelID == 1 {
+					return ChannelTypeWhatsapp, true
+				}
+				return "", false
+			},
+		})(fakeDoer(200, nil))
+
+		send := func(channelID string) time.Duration {
+			req, _ := http.NewRequest("DELETE", "http://example.com/channels/"+channelID, nil)
+
+			start := time.Now()
+			_, err := doer.Do(req)
+			require.NoError(t, err)
+			return time.Since(start)
+		}
+
+		require.Less(t, send("2"), 50*time.Millisecond)
+		require.Less(t, send("2"), 50*time.Millisecond)
+		require.Less(t, send("1"), 50*time.Millisecond)
+		require.GreaterOrEqual(t, send("1"), 400*time.Millisecond)
+	})
+
+	t.Run("upload bodies are not buffered", func(t *testing.T) {
+		t.Parallel()
+
+		global := &countingLimiter{}
+		file := io.NopCloser(strings.NewReader("file contents"))
+		doer := KeyedLimiter(KeyedLimiterSettings{Global: global})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			require.Nil(t, req.GetBody)
+			require.Equal(t, file, req.Body)
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}))
+
+		req, _ := http.NewRequest("POST", "http://example.com/files/upload", file)
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 1, global.calls)
+	})
+
+	t.Run("context cancellation stops waiting", func(t *testing.T) {
+		t.Parallel()
+
+		doer := KeyedLimiter(KeyedLimiterSettings{Default: KeyedRate{Rate: 0.1, Burst: 1}})(fakeDoer(200, nil))
+
+		req, _ := http.NewRequest("DELETE", "http://example.com/channels/1", nil)
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, _ = http.NewRequestWithContext(ctx, "DELETE", "http://example.com/channels/1", nil)
+		_, err = doer.Do(req)
+		require.Error(t, err)
+	})
+}
@@ -2,8 +2,12 @@ package transport_api_client
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,24 +17,62 @@ type Logger interface {
 	Log(ctx context.Context, format string, args ...interface{})
 }
 
+// StructuredLogger is a Logger that also accepts structured attributes.
+// The Logging middleware uses LogAttrs when the Logger implements it.
+type StructuredLogger interface {
+	Logger
+	LogAttrs(ctx context.Context, level LogLevel, msg string, attrs ...slog.Attr)
+}
+
 // Logging is a middleware that logs outgoing HTTP requests and their results.
 // It records the request method, URL, status code, and total duration
 // (including waiting in other middlewares such as Limiter).
+// Errors and responses with a 4xx or 5xx status are logged as failures with ERROR level.
+// When placed after Retry, each attempt is logged with its number, and when placed after
+// CorrelationID, each request is logged with its correlation ID.
+//
+// Results include the RequestTimings breakdown, except for the body read, which is not known yet.
+//
+// If l is a StructuredLogger, requests are logged with the attributes operation, method, path,
+// attempt, channel_id and correlation_id (when known), and results also with status, duration_ms, error
+// and the timings: limiter_wait_ms, dns_ms, connect_ms, tls_ms, ttfb_ms and conn_reused.
 func Logging(l Logger) Middleware {
+	if sl, ok := l.(StructuredLogger); ok {
+		return structuredLogging(sl)
+	}
+
 	return func(next HttpRequestDoer) HttpRequestDoer {
 		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req, timingsDone := withTimings(req)
 			ctx := req.Context()
 			start := time.Now()
 
-			l.Log(WithLogLevel(ctx, LogLevelDebug), "HTTP %s %s - started", req.Method, req.URL.String())
+			// details follow the URL, e.g. "(attempt 2) [correlation_id=abc]"
+			details := ""
+			if n := AttemptFromContext(ctx); n > 1 {
+				details = fmt.Sprintf(" (attempt %d)", n)
+			}
+			if id, ok := CorrelationIDFromContext(ctx); ok {
+				details += " [correlation_id=" + id + "]"
+			}
+
+			info := logRequestInfo{operation: operationName(req)}
+			l.Log(withLogRequestInfo(WithLogLevel(ctx, LogLevelDebug), info), "HTTP %s %s%s - started", req.Method, req.URL.String(), details)
 
 			resp, err := next.Do(req)
+			resp = timingsDone(resp)
 			dur := time.Since(start)
+			timings, _ := TimingsFromContext(ctx)
+
+			info.finished = true
+			info.failed = err != nil || isErrorResponse(resp)
+			info.duration = dur
+			ctx = withLogRequestInfo(ctx, info)
 
 			if err != nil {
 				l.Log(
-					WithLogLevel(ctx, LogLevelError), "HTTP %s %s - ERROR: %v (took %v)",
-					req.Method, req.URL.String(), err, dur,
+					WithLogLevel(ctx, LogLevelError), "HTTP %s %s%s - ERROR: %v (took %v%s)",
+					req.Method, req.URL.String(), details, err, dur, formatTimings(timings),
 				)
 				return nil, err
 			}
@@ -42,10 +84,15 @@ func Logging(l Logger) Middleware {
 				statusText = resp.Status
 			}
 
+			level := LogLevelDebug
+			if info.failed {
+				level = LogLevelError
+			}
+
 			l.Log(
-				WithLogLevel(ctx, LogLevelDebug),
-				"HTTP %s %s - %d %s (took %v)",
-				req.Method, req.URL.String(), statusCode, statusText, dur,
+				WithLogLevel(ctx, level),
+				"HTTP %s %s%s - %d %s (took %v%s)",
+				req.Method, req.URL.String(), details, statusCode, statusText, dur, formatTimings(timings),
 			)
 
 			return resp, nil
@@ -53,21 +100,241 @@ func Logging(l Logger) Middleware {
 	}
 }
 
+func structuredLogging(l StructuredLogger) Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := bufferJSONBody(req); err != nil {
+				return nil, err
+			}
+
+			req, timingsDone := withTimings(req)
+			ctx := req.Context()
+			start := time.Now()
+			attrs := requestLogAttrs(req)
+
+			l.LogAttrs(ctx, LogLevelDebug, "HTTP request started", attrs...)
+
+			resp, err := next.Do(req)
+			resp = timingsDone(resp)
+			attrs = append(attrs, durationAttr("duration_ms", time.Since(start)))
+			timings, _ := TimingsFromContext(ctx)
+			attrs = append(attrs, timingsLogAttrs(timings)...)
+
+			if err != nil {
+				l.LogAttrs(ctx, LogLevelError, "HTTP request failed", append(attrs, slog.String("error", err.Error()))...)
+				return nil, err
+			}
+
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			if isErrorResponse(resp) {
+				l.LogAttrs(ctx, LogLevelError, "HTTP request failed", attrs...)
+				return resp, nil
+			}
+
+			l.LogAttrs(ctx, LogLevelDebug, "HTTP request finished", attrs...)
+
+			return resp, nil
+		})
+	}
+}
+
+// isErrorResponse reports whether the response has a 4xx or 5xx status,
+// which the Logging middleware logs as a failure.
+func isErrorResponse(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode >= http.StatusBadRequest
+}
+
+// timingsLogAttrs returns the attributes of the timings known when the response headers are received.
+func timingsLogAttrs(t RequestTimings) []slog.Attr {
+	return []slog.Attr{
+		durationAttr("limiter_wait_ms", t.LimiterWait),
+		durationAttr("dns_ms", t.DNS),
+		durationAttr("connect_ms", t.Connect),
+		durationAttr("tls_ms", t.TLSHandshake),
+		durationAttr("ttfb_ms", t.TimeToFirstByte),
+		slog.Bool("conn_reused", t.ConnReused),
+	}
+}
+
+func durationAttr(key string, d time.Duration) slog.Attr {
+	return slog.Float64(key, float64(d.Microseconds())/1000)
+}
+
+// formatTimings formats the non-zero timings known when the response headers are received,
+// e.g. "; limiter 10ms, ttfb 80ms".
+func formatTimings(t RequestTimings) string {
+	var b strings.Builder
+	for _, p := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"limiter", t.LimiterWait},
+		{"dns", t.DNS},
+		{"connect", t.Connect},
+		{"tls", t.TLSHandshake},
+		{"ttfb", t.TimeToFirstByte},
+	} {
+		if p.d <= 0 {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("; ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(p.name + " " + p.d.String())
+	}
+
+	return b.String()
+}
+
+// requestLogAttrs returns the attributes identifying the request in structured logs.
+func requestLogAttrs(req *http.Request) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("operation", operationName(req)),
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.Int("attempt", AttemptFromContext(req.Context())),
+	}
+	if op, ok := requestOperation(req); ok && op.ChannelID != 0 {
+		attrs = append(attrs, slog.Int64("channel_id", op.ChannelID))
+	}
+	if id, ok := CorrelationIDFromContext(req.Context()); ok {
+		attrs = append(attrs, slog.String("correlation_id", id))
+	}
+
+	return attrs
+}
+
 // defaultLogger is a Logger implementation based on the standard log.Logger.
 // It automatically extracts log level from context (via LogLevelFromContext)
 // and prefixes each message with the level string.
-type defaultLogger struct{ *log.Logger }
+type defaultLogger struct {
+	*log.Logger
+
+	minLevel        LogLevel
+	operationLevels map[string]LogLevel
+	sampleEvery     uint64
+	slowThreshold   time.Duration
+	sampled         atomic.Uint64
+}
+
+// DefaultLoggerOption configures the Logger created by NewDefaultLogger.
+type DefaultLoggerOption func(*defaultLogger)
+
+// WithMinLogLevel drops messages below the level, e.g. LogLevelInfo drops the DEBUG lines
+// of successful requests. By default all messages are logged.
+func WithMinLogLevel(level LogLevel) DefaultLoggerOption {
+	return func(l *defaultLogger) { l.minLevel = level }
+}
+
+// WithOperationLogLevel overrides the minimum level for an operation, e.g.
+// WithOperationLogLevel("MarkMessageRead", LogLevelError) logs only its failures.
+func WithOperationLogLevel(operation string, level LogLevel) DefaultLoggerOption {
+	return func(l *defaultLogger) {
+		if l.operationLevels == nil {
+			l.operationLevels = make(map[string]LogLevel)
+		}
+		l.operationLevels[operation] = level
+	}
+}
+
+// WithSuccessSampling logs one of every n successful requests. Failed requests,
+// including responses with a 4xx or 5xx status, are always logged.
+// The "started" lines are not logged when sampling is enabled.
+func WithSuccessSampling(n int) DefaultLoggerOption {
+	return func(l *defaultLogger) {
+		if n > 1 {
+			l.sampleEvery = uint64(n)
+		}
+	}
+}
+
+// WithSlowThreshold logs only successful requests that took longer than the threshold,
+// with WARN level. Failed requests, including responses with a 4xx or 5xx status, are always logged.
+// The "started" lines are not logged when the threshold is set.
+func WithSlowThreshold(threshold time.Duration) DefaultLoggerOption {
+	return func(l *defaultLogger) { l.slowThreshold = threshold }
+}
 
 // Log implements Logger by prefixing messages with a log level
 // extracted from context, or falling back to INFO.
 func (l *defaultLogger) Log(ctx context.Context, format string, args ...interface{}) {
 	level := LogLevelFromContext(ctx)
+
+	info, ok := ctx.Value(ctxKeyLogRequestInfo{}).(logRequestInfo)
+	if ok && !info.failed && (l.sampleEvery > 0 || l.slowThreshold > 0) {
+		if !info.finished {
+			return
+		}
+		if l.slowThreshold > 0 {
+			if info.duration <= l.slowThreshold {
+				return
+			}
+			level = max(level, LogLevelWarn)
+		}
+		if l.sampleEvery > 0 && l.sampled.Add(1)%l.sampleEvery != 1 {
+			return
+		}
+	}
+
+	minLevel := l.minLevel
+	if ok {
+		if opLevel, found := l.operationLevels[info.operation]; found {
+			minLevel = opLevel
+		}
+	}
+	if level < minLevel {
+		return
+	}
+
 	l.Logger.Printf("[%s] "+format, append([]interface{}{level}, args...)...)
 }
 
 // NewDefaultLogger wraps a standard log.Logger into a Logger compatible with the Logging middleware.
-func NewDefaultLogger(l *log.Logger) Logger {
-	return &defaultLogger{l}
+func NewDefaultLogger(l *log.Logger, opts ...DefaultLoggerOption) Logger {
+	dl := &defaultLogger{Logger: l}
+	for _, opt := range opts {
+		opt(dl)
+	}
+
+	return dl
+}
+
+// logRequestInfo describes the request of a message logged by the Logging middleware,
+// so that the default logger can filter the messages.
+type logRequestInfo struct {
+	operation string
+	finished  bool
+	failed    bool
+	duration  time.Duration
+}
+
+type ctxKeyLogRequestInfo struct{}
+
+func withLogRequestInfo(ctx context.Context, info logRequestInfo) context.Context {
+	return context.WithValue(ctx, ctxKeyLogRequestInfo{}, info)
+}
+
+// slogLogger is a StructuredLogger implementation based on log/slog.
+type slogLogger struct{ *slog.Logger }
+
+// NewSlogLogger wraps a slog.Logger into a StructuredLogger compatible with the Logging middleware.
+// Messages logged with Log use the level from context (via LogLevelFromContext).
+func NewSlogLogger(l *slog.Logger) StructuredLogger {
+	return &slogLogger{l}
+}
+
+func (l *slogLogger) Log(ctx context.Context, format string, args ...interface{}) {
+	level := LogLevelFromContext(ctx).slogLevel()
+	if !l.Logger.Enabled(ctx, level) {
+		return
+	}
+	l.Logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (l *slogLogger) LogAttrs(ctx context.Context, level LogLevel, msg string, attrs ...slog.Attr) {
+	l.Logger.LogAttrs(ctx, level.slogLevel(), msg, attrs...)
 }
 
 // LogLevel defines severity levels for Logging middleware.
@@ -98,6 +365,21 @@ func (l LogLevel) String() string {
 	}
 }
 
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
+}
+
 type ctxKeyLogLevel struct{}
 
 // WithLogLevel returns a new context with the given log level
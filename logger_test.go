@@ -3,9 +3,14 @@ package transport_api_client
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -101,3 +106,219 @@ func TestLoggingMiddleware(t *testing.T) {
 		require.Equal(t, LogLevelInfo, LogLevelFromContext(ctx))
 	})
 }
+
+func TestStructuredLogging(t *testing.T) {
+	t.Parallel()
+
+	decode := func(t *testing.T, buf *bytes.Buffer) []map[string]any {
+		var records []map[string]any
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			var r map[string]any
+			require.NoError(t, dec.Decode(&r))
+			records = append(records, r)
+		}
+		return records
+	}
+
+	t.Run("request fields are logged", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+		doer := Logging(logger)(fakeDoer(200, nil))
+		req, _ := http.NewRequest("POST", "http://example.com/messages", strings.NewReader(`{"channel": 5}`))
+
+		req = req.WithContext(withAttempt(req.Context(), 2))
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+
+		records := decode(t, &buf)
+		require.Len(t, records, 2)
+		require.Equal(t, "HTTP request started", records[0]["msg"])
+		require.Equal(t, "DEBUG", records[0]["level"])
+
+		finished := records[1]
+		require.Equal(t, "HTTP request finished", finished["msg"])
+		require.Equal(t, "SendMessage", finished["operation"])
+		require.Equal(t, "POST", finished["method"])
+		require.Equal(t, "/messages", finished["path"])
+		require.Equal(t, 200.0, finished["status"])
+		require.Equal(t, 2.0, finished["attempt"])
+		require.Equal(t, 5.0, finished["channel_id"])
+		require.Contains(t, finished, "duration_ms")
+	})
+
+	t.Run("error is logged with error level", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+		doer := Logging(logger)(fakeDoer(0, context.DeadlineExceeded))
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		_, err := doer.Do(req)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		records := decode(t, &buf)
+		require.Len(t, records, 1, "debug records are filtered by the handler")
+		require.Equal(t, "ERROR", records[0]["level"])
+		require.Equal(t, "ListChannels", records[0]["operation"])
+		require.Equal(t, 1.0, records[0]["attempt"])
+		require.Equal(t, "context deadline exceeded", records[0]["error"])
+	})
+
+	t.Run("error response is logged as failure", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+		doer := Logging(logger)(fakeDoer(502, nil))
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 502, resp.StatusCode)
+
+		records := decode(t, &buf)
+		require.Len(t, records, 1)
+		require.Equal(t, "ERROR", records[0]["level"])
+		require.Equal(t, "HTTP request failed", records[0]["msg"])
+		require.Equal(t, 502.0, records[0]["status"])
+	})
+
+	t.Run("upload bodies are not buffered", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+		file := io.NopCloser(strings.NewReader("file contents"))
+		doer := Logging(logger)(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			require.Nil(t, req.GetBody)
+			require.Equal(t, file, req.Body)
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}))
+
+		req, _ := http.NewRequest("POST", "http://example.com/files/upload", file)
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+	})
+
+	t.Run("printf-style messages use level from context", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+		logger.Log(WithLogLevel(context.Background(), LogLevelWarn), "channel %d is %s", 1, "inactive")
+
+		records := decode(t, &buf)
+		require.Len(t, records, 1)
+		require.Equal(t, "WARN", records[0]["level"])
+		require.Equal(t, "channel 1 is inactive", records[0]["msg"])
+	})
+}
+
+func TestDefaultLoggerOptions(t *testing.T) {
+	t.Parallel()
+
+	run := func(doer HttpRequestDoer, method, path string, n int) {
+		for i := 0; i < n; i++ {
+			req, _ := http.NewRequest(method, "http://example.com"+path, nil)
+			_, _ = doer.Do(req)
+		}
+	}
+
+	t.Run("min level drops debug lines", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0), WithMinLogLevel(LogLevelInfo))
+
+		run(Logging(logger)(fakeDoer(200, nil)), "GET", "/channels", 1)
+		require.Empty(t, buf.String())
+
+		run(Logging(logger)(fakeDoer(0, context.DeadlineExceeded)), "GET", "/channels", 1)
+		require.Contains(t, buf.String(), "[ERROR] HTTP GET http://example.com/channels - ERROR")
+	})
+
+	t.Run("min level keeps error responses", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0), WithMinLogLevel(LogLevelInfo))
+
+		run(Logging(logger)(fakeDoer(400, nil)), "GET", "/channels", 1)
+		run(Logging(logger)(fakeDoer(503, nil)), "GET", "/templates", 1)
+
+		logs := buf.String()
+		require.Contains(t, logs, "[ERROR] HTTP GET http://example.com/channels - 400")
+		require.Contains(t, logs, "[ERROR] HTTP GET http://example.com/templates - 503")
+		require.NotContains(t, logs, "started")
+	})
+
+	t.Run("operation level overrides min level", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0), WithOperationLogLevel("MarkMessageRead", LogLevelError))
+		doer := Logging(logger)(fakeDoer(200, nil))
+
+		run(doer, "POST", "/messages/read", 1)
+		require.Empty(t, buf.String())
+
+		run(doer, "GET", "/channels", 1)
+		require.Contains(t, buf.String(), "[DEBUG] HTTP GET http://example.com/channels - 200")
+	})
+
+	t.Run("successful requests are sampled", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0), WithSuccessSampling(3))
+
+		run(Logging(logger)(fakeDoer(200, nil)), "GET", "/channels", 6)
+		run(Logging(logger)(fakeDoer(0, context.DeadlineExceeded)), "GET", "/channels", 2)
+
+		logs := buf.String()
+		require.Equal(t, 2, strings.Count(logs, "- 200"))
+		require.Equal(t, 2, strings.Count(logs, "- ERROR"))
+		require.NotContains(t, logs, "started")
+	})
+
+	t.Run("error responses are not sampled", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0), WithSuccessSampling(3), WithSlowThreshold(time.Hour))
+
+		run(Logging(logger)(fakeDoer(500, nil)), "GET", "/channels", 4)
+
+		require.Equal(t, 4, strings.Count(buf.String(), "[ERROR] HTTP GET http://example.com/channels - 500"))
+	})
+
+	t.Run("only slow requests are logged", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0), WithSlowThreshold(20*time.Millisecond))
+
+		run(Logging(logger)(fakeDoer(200, nil)), "GET", "/channels", 1)
+		require.Empty(t, buf.String())
+
+		slow := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			time.Sleep(30 * time.Millisecond)
+			return &http.Response{StatusCode: 200, Status: "200 OK", Body: http.NoBody}, nil
+		})
+		run(Logging(logger)(slow), "GET", "/templates", 1)
+		require.Contains(t, buf.String(), "[WARN] HTTP GET http://example.com/templates - 200")
+		require.NotContains(t, buf.String(), "started")
+	})
+}
@@ -0,0 +1,40 @@
+package transport_api_client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	created := 0
+	create := func() int {
+		created++
+		return created
+	}
+
+	c := newLRU[int64, int](2)
+
+	c.getOrAdd(1, create)
+	c.getOrAdd(2, create)
+	c.getOrAdd(1, create)
+	c.getOrAdd(3, create) // evicts 2
+	require.Equal(t, 3, created)
+
+	v, ok := c.get(1)
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	_, ok = c.get(2)
+	require.False(t, ok)
+
+	c.set(3, 30)
+	v, _ = c.get(3)
+	require.Equal(t, 30, v)
+
+	c.remove(3)
+	_, ok = c.get(3)
+	require.False(t, ok)
+}
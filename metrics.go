@@ -0,0 +1,86 @@
+package transport_api_client
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unknownOperation is the operation label of requests that don't match any API operation.
+const unknownOperation = "unknown"
+
+// MetricsRecorder receives metrics of client calls from the Metrics middleware.
+// Implementations must be safe for concurrent use. Package prommetrics implements it for Prometheus.
+type MetricsRecorder interface {
+	// RequestStarted is called before the request is sent.
+	RequestStarted(operation string)
+	// RequestFinished is called when the response headers are received or the request fails.
+	// Status is the HTTP status code, or "error" if no response was received.
+	RequestFinished(operation, status string, duration time.Duration)
+	// ErrorResponse is called for each error in the ErrorResponse body of a failed request.
+	// The message is the error text of MG as is, so recorders using it as a label should
+	// limit the number of its values.
+	ErrorResponse(operation, message string)
+}
+
+// TimingsRecorder is implemented by a MetricsRecorder that also records the RequestTimings breakdown.
+type TimingsRecorder interface {
+	// RequestTimings is called when the response body is closed, or when the request fails.
+	RequestTimings(operation string, timings RequestTimings)
+}
+
+// Metrics is a middleware that reports request counts, latency, in-flight requests
+// and the errors of error responses to the recorder. If the recorder implements TimingsRecorder,
+// the RequestTimings of each request are reported too.
+//
+// The operation is the API operation ID, e.g. "SendMessage", or "unknown" for other requests,
+// so that channel IDs and file UUIDs in paths don't become label values.
+func Metrics(recorder MetricsRecorder) Middleware {
+	timingsRecorder, recordTimings := recorder.(TimingsRecorder)
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			operation := unknownOperation
+			if op, ok := requestOperation(req); ok {
+				operation = op.ID
+			}
+
+			req, timingsDone := withTimings(req)
+			reportTimings := func() {
+				if timings, ok := TimingsFromContext(req.Context()); ok && recordTimings {
+					timingsRecorder.RequestTimings(operation, timings)
+				}
+			}
+
+			recorder.RequestStarted(operation)
+			start := time.Now()
+
+			resp, err := next.Do(req)
+			resp = timingsDone(resp)
+			if err != nil {
+				recorder.RequestFinished(operation, "error", time.Since(start))
+				reportTimings()
+				return nil, err
+			}
+
+			recorder.RequestFinished(operation, strconv.Itoa(resp.StatusCode), time.Since(start))
+
+			if resp.StatusCode >= http.StatusBadRequest {
+				for _, msg := range responseErrors(resp) {
+					recorder.ErrorResponse(operation, msg)
+				}
+			}
+
+			if !recordTimings {
+				return resp, nil
+			}
+			if resp.Body == nil {
+				reportTimings()
+				return resp, nil
+			}
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: reportTimings}
+
+			return resp, nil
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package transport_api_client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMetricsRecorder counts the calls of the Metrics middleware.
+type fakeMetricsRecorder struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	requests map[string]int
+	errors   []string
+	timings  []RequestTimings
+}
+
+func newFakeMetricsRecorder() *fakeMetricsRecorder {
+	return &fakeMetricsRecorder{inFlight: make(map[string]int), requests: make(map[string]int)}
+}
+
+func (r *fakeMetricsRecorder) RequestStarted(operation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[operation]++
+}
+
+func (r *fakeMetricsRecorder) RequestFinished(operation, status string, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[operation]--
+	r.requests[operation+" "+status]++
+}
+
+func (r *fakeMetricsRecorder) ErrorResponse(operation, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, operation+": "+message)
+}
+
+func (r *fakeMetricsRecorder) RequestTimings(_ string, timings RequestTimings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timings = append(r.timings, timings)
+}
+
+func (r *fakeMetricsRecorder) inFlightOf(operation string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inFlight[operation]
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	t.Parallel()
+
+	recorder := newFakeMetricsRecorder()
+
+	doer := Metrics(recorder)(DoerFunc(func(req *http.Request) (*http.Response, error) {
+		if op, ok := findOperation(req.Method, req.URL.Path); ok {
+			require.Equal(t, 1, recorder.inFlightOf(op.id))
+		}
+
+		switch req.URL.Path {
+		case "/channels/1":
+			return &http.Response{
+				StatusCode: 404,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"errors": ["channel not found"]}`)),
+			}, nil
+		case "/broken":
+			return nil, errors.New("connection refused")
+		default:
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}
+	}))
+
+	for _, path := range []string{"/channels", "/channels", "/channels/1", "/broken"} {
+		method := "GET"
+		if path == "/channels/1" {
+			method = "PUT"
+		}
+		req, _ := http.NewRequest(method, "http://example.com"+path, nil)
+		resp, err := doer.Do(req)
+		if path == "/broken" {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		if path == "/channels/1" {
+			parsed, err := ParseUpdateChannelResp(resp)
+			require.NoError(t, err)
+			require.Equal(t, []string{"channel not found"}, parsed.JSONDefault.Errors, "body is left intact")
+		}
+	}
+
+	require.Equal(t, map[string]int{
+		"ListChannels 200":  2,
+		"UpdateChannel 404": 1,
+		"unknown error":     1,
+	}, recorder.requests)
+	require.Equal(t, []string{"UpdateChannel: channel not found"}, recorder.errors)
+	require.Equal(t, 0, recorder.inFlightOf("ListChannels"))
+}
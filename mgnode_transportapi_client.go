@@ -1,13 +1,11 @@
 package transport_api_client
 
-import (
-	"errors"
-)
-
 type Err interface {
 	Error() error
 }
 
+// ExtractError returns the transport error if it is not nil, otherwise the error
+// described by the response. Error responses are returned as *APIError.
 func ExtractError(resp Err, err error) error {
 	if err != nil {
 		return err
@@ -20,170 +18,359 @@ func ExtractError(resp Err, err error) error {
 	return nil
 }
 
+// StrictErr is implemented by all the response types of ClientWithResponses.
+type StrictErr interface {
+	Err
+	StrictError() error
+}
+
+// ExtractStrictError is like ExtractError, but it also treats responses with a non-2xx status
+// and 2xx responses without a JSON body as errors. Such errors are returned as *APIError
+// with the status code and the raw body, e.g. an HTML page from a proxy.
+func ExtractStrictError(resp StrictErr, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if resp != nil {
+		return resp.StrictError()
+	}
+
+	return nil
+}
+
 func (r ListChannelsResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("ListChannels", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r ListChannelsResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("ListChannels", r.HTTPResponse, r.Body)
+}
+
 func (r ActivateChannelResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("ActivateChannel", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r ActivateChannelResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("ActivateChannel", r.HTTPResponse, r.Body)
+}
+
 func (r DeactivateChannelResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("DeactivateChannel", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r DeactivateChannelResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("DeactivateChannel", r.HTTPResponse, r.Body)
+}
+
 func (r UpdateChannelResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("UpdateChannel", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r UpdateChannelResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("UpdateChannel", r.HTTPResponse, r.Body)
+}
+
 func (r ActivateTemplateResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("ActivateTemplate", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r ActivateTemplateResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("ActivateTemplate", r.HTTPResponse, r.Body)
+}
+
 func (r DeactivateTemplateResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("DeactivateTemplate", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r DeactivateTemplateResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("DeactivateTemplate", r.HTTPResponse, r.Body)
+}
+
 func (r UpdateTemplateResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("UpdateTemplate", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r UpdateTemplateResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("UpdateTemplate", r.HTTPResponse, r.Body)
+}
+
 func (r UploadFileResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("UploadFile", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r UploadFileResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("UploadFile", r.HTTPResponse, r.Body)
+}
+
 func (r UploadFileByUrlResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("UploadFileByUrl", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r UploadFileByUrlResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("UploadFileByUrl", r.HTTPResponse, r.Body)
+}
+
 func (r GetFileUrlResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("GetFileUrl", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r GetFileUrlResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("GetFileUrl", r.HTTPResponse, r.Body)
+}
+
 func (r DeleteMessageResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("DeleteMessage", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r DeleteMessageResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("DeleteMessage", r.HTTPResponse, r.Body)
+}
+
 func (r SendMessageResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("SendMessage", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r SendMessageResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("SendMessage", r.HTTPResponse, r.Body)
+}
+
 func (r EditMessageResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("EditMessage", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r EditMessageResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("EditMessage", r.HTTPResponse, r.Body)
+}
+
 func (r AckMessageResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("AckMessage", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r AckMessageResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("AckMessage", r.HTTPResponse, r.Body)
+}
+
 func (r SendHistoryMessageResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("SendHistoryMessage", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r SendHistoryMessageResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("SendHistoryMessage", r.HTTPResponse, r.Body)
+}
+
 func (r DeleteMessageReactionResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("DeleteMessageReaction", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r DeleteMessageReactionResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("DeleteMessageReaction", r.HTTPResponse, r.Body)
+}
+
 func (r AddMessageReactionResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("AddMessageReaction", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r AddMessageReactionResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("AddMessageReaction", r.HTTPResponse, r.Body)
+}
+
 func (r MarkMessageReadResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("MarkMessageRead", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r MarkMessageReadResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("MarkMessageRead", r.HTTPResponse, r.Body)
+}
+
 func (r MarkMessagesReadUntilResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("MarkMessagesReadUntil", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r MarkMessagesReadUntilResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("MarkMessagesReadUntil", r.HTTPResponse, r.Body)
+}
+
 func (r RestoreMessageResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("RestoreMessage", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
 
+func (r RestoreMessageResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("RestoreMessage", r.HTTPResponse, r.Body)
+}
+
 func (r GetTemplatesResp) Error() error {
 	if r.JSONDefault != nil {
-		return errors.New(r.JSONDefault.Errors[0])
+		return newAPIError("GetTemplates", r.HTTPResponse, r.Body, r.JSONDefault)
 	}
 
 	return nil
 }
+
+func (r GetTemplatesResp) StrictError() error {
+	if err := r.Error(); err != nil {
+		return err
+	}
+
+	return unexpectedResponseError("GetTemplates", r.HTTPResponse, r.Body)
+}
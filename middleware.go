@@ -9,16 +9,20 @@ import (
 type Middleware func(HttpRequestDoer) HttpRequestDoer
 
 // WithMiddlewares applies a chain of middlewares to the client.
-// Middlewares are applied in the order they are passed.
+// Middlewares are applied in the order they are passed: the first one receives
+// the request first and the response last.
+// The OperationInfo of each request is available to them with OperationFromContext.
 func WithMiddlewares(mws ...Middleware) ClientOption {
 	return func(c *Client) error {
 		if c.Client == nil {
 			c.Client = &http.Client{}
 		}
 
-		for _, mw := range mws {
-			c.Client = mw(c.Client)
+		for i := len(mws) - 1; i >= 0; i-- {
+			c.Client = mws[i](c.Client)
 		}
+		c.Client = describeOperation(c.Client)
+
 		return nil
 	}
 }
@@ -73,4 +73,35 @@ func TestMiddleware(t *testing.T) {
 			order,
 		)
 	})
+
+	t.Run("WithMiddlewares applies middlewares in the order they are passed", func(t *testing.T) {
+		t.Parallel()
+
+		var order []string
+		named := func(name string) Middleware {
+			return func(next HttpRequestDoer) HttpRequestDoer {
+				return DoerFunc(func(req *http.Request) (*http.Response, error) {
+					order = append(order, name+"-before")
+					resp, err := next.Do(req)
+					order = append(order, name+"-after")
+					return resp, err
+				})
+			}
+		}
+
+		c := &Client{Client: DoerFunc(func(req *http.Request) (*http.Response, error) {
+			order = append(order, "final")
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})}
+		require.NoError(t, WithMiddlewares(named("mw1"), named("mw2"))(c))
+
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		_, err := c.Client.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t,
+			[]string{"mw1-before", "mw2-before", "final", "mw2-after", "mw1-after"},
+			order,
+		)
+	})
 }
@@ -0,0 +1,243 @@
+package transport_api_client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// operation describes a Transport API operation by its HTTP method and path pattern.
+type operation struct {
+	id         string
+	group      OperationGroup
+	method     string
+	path       string
+	idempotent bool
+}
+
+// OperationGroup groups related API operations, e.g. all the message operations.
+type OperationGroup string
+
+const (
+	OperationGroupChannels  OperationGroup = "channels"
+	OperationGroupTemplates OperationGroup = "templates"
+	OperationGroupFiles     OperationGroup = "files"
+	OperationGroupMessages  OperationGroup = "messages"
+)
+
+// operations lists all the Transport API operations. Patterns with more segments go first,
+// so that the most specific pattern is matched.
+var operations = []operation{
+	{id: "DeactivateTemplate", group: OperationGroupTemplates, method: http.MethodDelete, path: "/channels/{channel_id}/templates/{template_code}"},
+	{id: "UpdateTemplate", group: OperationGroupTemplates, method: http.MethodPut, path: "/channels/{channel_id}/templates/{template_code}"},
+	{id: "ActivateTemplate", group: OperationGroupTemplates, method: http.MethodPost, path: "/channels/{channel_id}/templates"},
+	{id: "DeactivateChannel", group: OperationGroupChannels, method: http.MethodDelete, path: "/channels/{channel_id}"},
+	{id: "UpdateChannel", group: OperationGroupChannels, method: http.MethodPut, path: "/channels/{channel_id}"},
+	{id: "UploadFile", group: OperationGroupFiles, method: http.MethodPost, path: "/files/upload"},
+	{id: "UploadFileByUrl", group: OperationGroupFiles, method: http.MethodPost, path: "/files/upload_by_url"},
+	{id: "GetFileUrl", group: OperationGroupFiles, method: http.MethodGet, path: "/files/{file_uuid}", idempotent: true},
+	{id: "AckMessage", group: OperationGroupMessages, method: http.MethodPost, path: "/messages/ack"},
+	{id: "SendHistoryMessage", group: OperationGroupMessages, method: http.MethodPost, path: "/messages/history"},
+	{id: "DeleteMessageReaction", group: OperationGroupMessages, method: http.MethodDelete, path: "/messages/reaction"},
+	{id: "AddMessageReaction", group: OperationGroupMessages, method: http.MethodPost, path: "/messages/reaction"},
+	{id: "MarkMessageRead", group: OperationGroupMessages, method: http.MethodPost, path: "/messages/read"},
+	{id: "MarkMessagesReadUntil", group: OperationGroupMessages, method: http.MethodPost, path: "/messages/read_until"},
+	{id: "RestoreMessage", group: OperationGroupMessages, method: http.MethodPost, path: "/messages/restore"},
+	{id: "ListChannels", group: OperationGroupChannels, method: http.MethodGet, path: "/channels", idempotent: true},
+	{id: "ActivateChannel", group: OperationGroupChannels, method: http.MethodPost, path: "/channels"},
+	{id: "DeleteMessage", group: OperationGroupMessages, method: http.MethodDelete, path: "/messages"},
+	{id: "SendMessage", group: OperationGroupMessages, method: http.MethodPost, path: "/messages"},
+	{id: "EditMessage", group: OperationGroupMessages, method: http.MethodPut, path: "/messages"},
+	{id: "GetTemplates", group: OperationGroupTemplates, method: http.MethodGet, path: "/templates", idempotent: true},
+}
+
+// OperationInfo describes the API operation of a request.
+type OperationInfo struct {
+	// ID is the operation ID from the API specification, e.g. "SendMessage".
+	ID string
+	// Group is the group of the operation.
+	Group OperationGroup
+	// Idempotent is true if the request is safe to be repeated. SendMessage is idempotent
+	// only when the message has an external_id, which MG uses for deduplication.
+	Idempotent bool
+	// ChannelID is the channel from the path or the request body, or zero if unknown.
+	ChannelID int64
+	// TemplateCode is the template code of UpdateTemplate and DeactivateTemplate.
+	TemplateCode string
+	// FileUUID is the file of GetFileUrl.
+	FileUUID string
+}
+
+type ctxKeyOperation struct{}
+
+// WithOperation returns a new context with the operation info.
+func WithOperation(ctx context.Context, info OperationInfo) context.Context {
+	return context.WithValue(ctx, ctxKeyOperation{}, info)
+}
+
+// OperationFromContext returns the operation of the request. WithMiddlewares puts it into
+// the request context, so it is available to all middlewares.
+func OperationFromContext(ctx context.Context) (OperationInfo, bool) {
+	info, ok := ctx.Value(ctxKeyOperation{}).(OperationInfo)
+	return info, ok
+}
+
+// describeOperation is a middleware that puts the OperationInfo of the request into its context.
+func describeOperation(next HttpRequestDoer) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		if _, ok := OperationFromContext(req.Context()); ok {
+			return next.Do(req)
+		}
+
+		// JSON bodies are buffered to find the channel ID and the message external_id
+		if err := bufferJSONBody(req); err != nil {
+			return nil, err
+		}
+
+		if info, ok := describeRequest(req); ok {
+			req = req.WithContext(WithOperation(req.Context(), info))
+		}
+
+		return next.Do(req)
+	})
+}
+
+// bufferJSONBody buffers JSON request bodies, which are small, so that their fields can be read
+// with req.GetBody. Other bodies, e.g. file uploads, are left as is.
+func bufferJSONBody(req *http.Request) error {
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+
+	return ensureGetBody(req)
+}
+
+// requestOperation returns the operation of the request from its context,
+// or finds it by the request method and path.
+func requestOperation(req *http.Request) (OperationInfo, bool) {
+	if info, ok := OperationFromContext(req.Context()); ok {
+		return info, true
+	}
+
+	return describeRequest(req)
+}
+
+// describeRequest finds the operation by the request method and path
+// and extracts its parameters from the path and the body.
+func describeRequest(req *http.Request) (OperationInfo, bool) {
+	op, ok := findOperation(req.Method, req.URL.Path)
+	if !ok {
+		return OperationInfo{}, false
+	}
+
+	info := OperationInfo{ID: op.id, Group: op.group, Idempotent: op.idempotent}
+	if op.id == "SendMessage" {
+		info.Idempotent = hasMessageExternalID(req)
+	}
+	if channelID, ok := channelIDFromRequest(req); ok {
+		info.ChannelID = channelID
+	}
+
+	params := pathParams(req.URL.Path, op.path)
+	info.TemplateCode = params["template_code"]
+	info.FileUUID = params["file_uuid"]
+
+	return info, true
+}
+
+// findOperation returns the operation matching the request method and URL path.
+// The path may contain the server base path, e.g. /api/transport/v1/channels.
+func findOperation(method, path string) (operation, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, op := range operations {
+		if op.method == method && matchPathSuffix(segments, op.path) {
+			return op, true
+		}
+	}
+
+	return operation{}, false
+}
+
+// matchPathSuffix reports whether the last path segments match the pattern.
+// Pattern segments in braces match any non-empty segment.
+func matchPathSuffix(segments []string, pattern string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(segments) < len(patternSegments) {
+		return false
+	}
+
+	segments = segments[len(segments)-len(patternSegments):]
+	for i, ps := range patternSegments {
+		if strings.HasPrefix(ps, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+
+		if segments[i] != ps {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pathParams returns the values of the pattern segments in braces from the matching path suffix.
+func pathParams(path, pattern string) map[string]string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments = segments[len(segments)-len(patternSegments):]
+
+	params := make(map[string]string)
+	for i, ps := range patternSegments {
+		if strings.HasPrefix(ps, "{") {
+			params[strings.Trim(ps, "{}")] = segments[i]
+		}
+	}
+
+	return params
+}
+
+// channelIDFromRequest returns the channel ID from the /channels/{channel_id} path,
+// or from the channel or channel_id field of the JSON request body.
+// The body is read using req.GetBody, so it is left intact.
+func channelIDFromRequest(req *http.Request) (int64, bool) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i := len(segments) - 2; i >= 0; i-- {
+		if segments[i] == "channels" {
+			id, err := strconv.ParseInt(segments[i+1], 10, 64)
+			return id, err == nil
+		}
+	}
+
+	if req.GetBody == nil {
+		return 0, false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return 0, false
+	}
+	defer func() { _ = body.Close() }()
+
+	var fields struct {
+		Channel   *int64 `json:"channel"`
+		ChannelID *int64 `json:"channel_id"`
+	}
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return 0, false
+	}
+
+	switch {
+	case fields.Channel != nil:
+		return *fields.Channel, true
+	case fields.ChannelID != nil:
+		return *fields.ChannelID, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,135 @@
+package transport_api_client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindOperation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		path   string
+		id     string
+	}{
+		{http.MethodGet, "/api/transport/v1/channels", "ListChannels"},
+		{http.MethodPost, "/channels", "ActivateChannel"},
+		{http.MethodDelete, "/channels/10", "DeactivateChannel"},
+		{http.MethodPut, "/channels/10", "UpdateChannel"},
+		{http.MethodPost, "/channels/10/templates", "ActivateTemplate"},
+		{http.MethodDelete, "/channels/10/templates/code", "DeactivateTemplate"},
+		{http.MethodPut, "/channels/10/templates/code", "UpdateTemplate"},
+		{http.MethodPost, "/files/upload", "UploadFile"},
+		{http.MethodPost, "/files/upload_by_url", "UploadFileByUrl"},
+		{http.MethodGet, "/files/0d9f8c6e-2bb0-4c5a-9b57-6d6f6b1d5f3a", "GetFileUrl"},
+		{http.MethodDelete, "/messages", "DeleteMessage"},
+		{http.MethodPost, "/messages", "SendMessage"},
+		{http.MethodPut, "/messages", "EditMessage"},
+		{http.MethodPost, "/messages/ack", "AckMessage"},
+		{http.MethodPost, "/messages/history", "SendHistoryMessage"},
+		{http.MethodDelete, "/messages/reaction", "DeleteMessageReaction"},
+		{http.MethodPost, "/messages/reaction", "AddMessageReaction"},
+		{http.MethodPost, "/messages/read", "MarkMessageRead"},
+		{http.MethodPost, "/messages/read_until", "MarkMessagesReadUntil"},
+		{http.MethodPost, "/messages/restore", "RestoreMessage"},
+		{http.MethodGet, "/api/transport/v1/templates", "GetTemplates"},
+	}
+
+	for _, tc := range testCases {
+		op, ok := findOperation(tc.method, tc.path)
+		require.True(t, ok, "%s %s", tc.method, tc.path)
+		require.Equal(t, tc.id, op.id, "%s %s", tc.method, tc.path)
+	}
+
+	_, ok := findOperation(http.MethodGet, "/unknown")
+	require.False(t, ok)
+
+	_, ok = findOperation(http.MethodPatch, "/messages")
+	require.False(t, ok)
+}
+
+func TestChannelIDFromRequest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		url    string
+		body   string
+		id     int64
+		ok     bool
+	}{
+		{"DELETE", "http://example.com/api/transport/v1/channels/15", "", 15, true},
+		{"PUT", "http://example.com/channels/16/templates/code", `{"name": "test"}`, 16, true},
+		{"POST", "http://example.com/messages", `{"channel": 17, "message": {}}`, 17, true},
+		{"POST", "http://example.com/messages/read", `{"channel_id": 18, "message": {}}`, 18, true},
+		{"GET", "http://example.com/channels", "", 0, false},
+		{"POST", "http://example.com/files/upload", "--boundary", 0, false},
+	}
+
+	for _, tc := range testCases {
+		var req *http.Request
+		if tc.body != "" {
+			req, _ = http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		} else {
+			req, _ = http.NewRequest(tc.method, tc.url, nil)
+		}
+
+		id, ok := channelIDFromRequest(req)
+		require.Equal(t, tc.ok, ok, tc.url)
+		require.Equal(t, tc.id, id, tc.url)
+	}
+}
+
+func TestOperationFromContext(t *testing.T) {
+	t.Parallel()
+
+	var got []OperationInfo
+	capture := func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			info, ok := OperationFromContext(req.Context())
+			require.True(t, ok, "%s %s", req.Method, req.URL.Path)
+			got = append(got, info)
+			return next.Do(req)
+		})
+	}
+
+	c, err := NewClient(
+		"https://mg.example.com/api/transport/v1",
+		WithHTTPClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})),
+		WithMiddlewares(capture),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	externalID := "ext-1"
+
+	_, err = c.UpdateTemplate(ctx, 10, "greeting", UpdateTemplateJSONRequestBody{})
+	require.NoError(t, err)
+	_, err = c.GetFileUrl(ctx, "0d9f8c6e-2bb0-4c5a-9b57-6d6f6b1d5f3a")
+	require.NoError(t, err)
+	_, err = c.SendMessage(ctx, SendMessageJSONRequestBody{Channel: 7, Message: SendMessageRequestMessage{ExternalID: &externalID}})
+	require.NoError(t, err)
+	_, err = c.SendMessage(ctx, SendMessageJSONRequestBody{Channel: 7})
+	require.NoError(t, err)
+
+	require.Equal(t, []OperationInfo{
+		{ID: "UpdateTemplate", Group: OperationGroupTemplates, ChannelID: 10, TemplateCode: "greeting"},
+		{ID: "GetFileUrl", Group: OperationGroupFiles, Idempotent: true, FileUUID: "0d9f8c6e-2bb0-4c5a-9b57-6d6f6b1d5f3a"},
+		{ID: "SendMessage", Group: OperationGroupMessages, Idempotent: true, ChannelID: 7},
+		{ID: "SendMessage", Group: OperationGroupMessages, ChannelID: 7},
+	}, got)
+
+	// operation set by the caller is kept
+	custom := OperationInfo{ID: "Custom"}
+	req, _ := http.NewRequestWithContext(WithOperation(ctx, custom), "GET", "https://mg.example.com/channels", nil)
+	_, err = c.Client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, custom, got[len(got)-1])
+}
@@ -0,0 +1,196 @@
+// Package prommetrics exports the metrics of the transport_api_client.Metrics middleware to Prometheus.
+package prommetrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	transport_api_client "github.com/retailcrm/transport-api-client-go"
+)
+
+// OtherErrors is the error label of the errors beyond Settings.MaxErrorLabels.
+const OtherErrors = "other"
+
+// maxErrorLabelLength is the maximum length of an error label in bytes.
+const maxErrorLabelLength = 100
+
+var (
+	_ transport_api_client.MetricsRecorder = (*Metrics)(nil)
+	_ transport_api_client.TimingsRecorder = (*Metrics)(nil)
+)
+
+// Settings configures Metrics.
+type Settings struct {
+	// Namespace and Subsystem prefix the metric names. Default is "mg_transport_client".
+	Namespace string
+	Subsystem string
+	// Buckets of the latency histogram. Default is prometheus.DefBuckets.
+	Buckets []float64
+	// Registerer registers the metrics. Default is prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// MaxErrorLabels is the number of distinct error label values; further errors are
+	// counted as OtherErrors. Default is 50.
+	MaxErrorLabels int
+}
+
+// Metrics is a transport_api_client.MetricsRecorder that exports the metrics to Prometheus:
+//   - requests_total{operation, status} counter
+//   - request_duration_seconds{operation, status} histogram
+//   - requests_in_flight{operation} gauge
+//   - error_responses_total{operation, error} counter
+//   - request_phase_duration_seconds{operation, phase} histogram of non-zero RequestTimings phases:
+//     limiter_wait, dns, connect, tls_handshake, ttfb and body_read
+//
+// The error label is the MG error message with numbers replaced by "N", truncated to 100 bytes.
+type Metrics struct {
+	requests       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	phases         *prometheus.HistogramVec
+	inFlight       *prometheus.GaugeVec
+	errorResponses *prometheus.CounterVec
+
+	maxErrorLabels int
+	mu             sync.Mutex
+	errorLabels    map[string]struct{}
+}
+
+// New creates Metrics and registers its metrics.
+func New(s Settings) (*Metrics, error) {
+	if s.Namespace == "" && s.Subsystem == "" {
+		s.Namespace = "mg_transport_client"
+	}
+	if s.Buckets == nil {
+		s.Buckets = prometheus.DefBuckets
+	}
+	if s.Registerer == nil {
+		s.Registerer = prometheus.DefaultRegisterer
+	}
+	if s.MaxErrorLabels <= 0 {
+		s.MaxErrorLabels = 50
+	}
+
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: s.Namespace,
+			Subsystem: s.Subsystem,
+			Name:      "requests_total",
+			Help:      "Number of MG Transport API requests by operation and status code.",
+		}, []string{"operation", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: s.Namespace,
+			Subsystem: s.Subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of MG Transport API requests until the response headers are received.",
+			Buckets:   s.Buckets,
+		}, []string{"operation", "status"}),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: s.Namespace,
+			Subsystem: s.Subsystem,
+			Name:      "request_phase_duration_seconds",
+			Help:      "Duration of MG Transport API request phases: limiter wait, DNS, connect, TLS, TTFB and body read.",
+			Buckets:   s.Buckets,
+		}, []string{"operation", "phase"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: s.Namespace,
+			Subsystem: s.Subsystem,
+			Name:      "requests_in_flight",
+			Help:      "Number of MG Transport API requests waiting for a response.",
+		}, []string{"operation"}),
+		errorResponses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: s.Namespace,
+			Subsystem: s.Subsystem,
+			Name:      "error_responses_total",
+			Help:      "Number of errors in MG Transport API error responses by operation and error.",
+		}, []string{"operation", "error"}),
+		maxErrorLabels: s.MaxErrorLabels,
+		errorLabels:    make(map[string]struct{}),
+	}
+
+	for _, c := range []prometheus.Collector{m.requests, m.duration, m.phases, m.inFlight, m.errorResponses} {
+		if err := s.Registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) RequestStarted(operation string) {
+	m.inFlight.WithLabelValues(operation).Inc()
+}
+
+func (m *Metrics) RequestFinished(operation, status string, duration time.Duration) {
+	m.inFlight.WithLabelValues(operation).Dec()
+	m.requests.WithLabelValues(operation, status).Inc()
+	m.duration.WithLabelValues(operation, status).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ErrorResponse(operation, message string) {
+	m.errorResponses.WithLabelValues(operation, m.errorLabel(message)).Inc()
+}
+
+func (m *Metrics) RequestTimings(operation string, t transport_api_client.RequestTimings) {
+	for _, p := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"limiter_wait", t.LimiterWait},
+		{"dns", t.DNS},
+		{"connect", t.Connect},
+		{"tls_handshake", t.TLSHandshake},
+		{"ttfb", t.TimeToFirstByte},
+		{"body_read", t.BodyRead},
+	} {
+		if p.d > 0 {
+			m.phases.WithLabelValues(operation, p.name).Observe(p.d.Seconds())
+		}
+	}
+}
+
+// errorLabel returns the label of an error message, or OtherErrors when the number
+// of distinct labels reached MaxErrorLabels.
+func (m *Metrics) errorLabel(message string) string {
+	label := normalizeError(message)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.errorLabels[label]; ok {
+		return label
+	}
+	if len(m.errorLabels) >= m.maxErrorLabels {
+		return OtherErrors
+	}
+	m.errorLabels[label] = struct{}{}
+
+	return label
+}
+
+// normalizeError replaces numbers in the message with "N", e.g. IDs of chats and messages,
+// and truncates it to maxErrorLabelLength.
+func normalizeError(message string) string {
+	var b strings.Builder
+	inNumber := false
+	for _, r := range strings.TrimSpace(message) {
+		if unicode.IsDigit(r) {
+			if inNumber {
+				continue
+			}
+			inNumber = true
+			r = 'N'
+		} else {
+			inNumber = false
+		}
+		if b.Len()+utf8.RuneLen(r) > maxErrorLabelLength {
+			break
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
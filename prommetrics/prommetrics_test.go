@@ -0,0 +1,104 @@
+package prommetrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	transport_api_client "github.com/retailcrm/transport-api-client-go"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	t.Run("requests are recorded", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == http.MethodPut {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errors": ["channel 42 not found"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		t.Cleanup(srv.Close)
+
+		registry := prometheus.NewRegistry()
+		metrics, err := New(Settings{Registerer: registry})
+		require.NoError(t, err)
+
+		c, err := transport_api_client.NewClientWithResponses(srv.URL, transport_api_client.WithMiddlewares(
+			transport_api_client.Metrics(metrics),
+		))
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			_, err = c.ListChannelsWithResponse(context.Background(), nil)
+			require.NoError(t, err)
+		}
+		_, err = c.UpdateChannelWithResponse(context.Background(), 42, transport_api_client.UpdateChannelJSONRequestBody{})
+		require.NoError(t, err)
+
+		require.Equal(t, 2.0, testutil.ToFloat64(metrics.requests.WithLabelValues("ListChannels", "200")))
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("UpdateChannel", "404")))
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.errorResponses.WithLabelValues("UpdateChannel", "channel N not found")))
+		require.Equal(t, 0.0, testutil.ToFloat64(metrics.inFlight.WithLabelValues("ListChannels")))
+		require.Equal(t, 2, testutil.CollectAndCount(metrics.duration))
+		require.Positive(t, testutil.CollectAndCount(metrics.phases))
+
+		_, err = New(Settings{Registerer: registry})
+		require.Error(t, err, "metrics are already registered")
+	})
+
+	t.Run("error labels are bounded", func(t *testing.T) {
+		t.Parallel()
+
+		metrics, err := New(Settings{Registerer: prometheus.NewRegistry(), MaxErrorLabels: 2})
+		require.NoError(t, err)
+
+		for _, msg := range []string{"chat 1 not found", "chat 2 not found", "invalid token", "invalid text", strings.Repeat("x", 200)} {
+			metrics.ErrorResponse("SendMessage", msg)
+		}
+
+		require.Equal(t, 2.0, testutil.ToFloat64(metrics.errorResponses.WithLabelValues("SendMessage", "chat N not found")))
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.errorResponses.WithLabelValues("SendMessage", "invalid token")))
+		require.Equal(t, 2.0, testutil.ToFloat64(metrics.errorResponses.WithLabelValues("SendMessage", OtherErrors)))
+		require.Equal(t, 3, testutil.CollectAndCount(metrics.errorResponses))
+	})
+
+	t.Run("timings are recorded", func(t *testing.T) {
+		t.Parallel()
+
+		metrics, err := New(Settings{Registerer: prometheus.NewRegistry()})
+		require.NoError(t, err)
+
+		metrics.RequestTimings("ListChannels", transport_api_client.RequestTimings{
+			Connect:         time.Millisecond,
+			TimeToFirstByte: 2 * time.Millisecond,
+		})
+
+		require.Equal(t, 2, testutil.CollectAndCount(metrics.phases), "connect and ttfb")
+	})
+}
+
+func TestNormalizeError(t *testing.T) {
+	t.Parallel()
+
+	for msg, want := range map[string]string{
+		"channel not found":           "channel not found",
+		" message 123456 of chat 78 ": "message N of chat N",
+		strings.Repeat("ab", 100):     strings.Repeat("ab", 50),
+		strings.Repeat("я", 60):       strings.Repeat("я", 50),
+	} {
+		require.Equal(t, want, normalizeError(msg), msg)
+	}
+}
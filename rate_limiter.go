@@ -4,6 +4,7 @@ import (
 	"context"
 	"golang.org/x/time/rate"
 	"net/http"
+	"time"
 )
 
 // RateLimiter abstracts a token bucket rate limiter.
@@ -13,10 +14,14 @@ type RateLimiter interface {
 
 // Limiter is a middleware that applies a RateLimiter before forwarding the request.
 // If the limiter denies the request (e.g. due to context cancellation), an error is returned.
+// The wait time is added to RequestTimings.LimiterWait.
 func Limiter(l RateLimiter) Middleware {
 	return func(next HttpRequestDoer) HttpRequestDoer {
 		return DoerFunc(func(req *http.Request) (*http.Response, error) {
-			if err := l.Wait(req.Context()); err != nil {
+			start := time.Now()
+			err := l.Wait(req.Context())
+			addLimiterWait(req.Context(), time.Since(start))
+			if err != nil {
 				return nil, err
 			}
 
@@ -0,0 +1,484 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecordFormat is the output format of a TrafficRecorder.
+type RecordFormat int
+
+const (
+	// RecordJSONL writes one JSON object per call and line.
+	RecordJSONL RecordFormat = iota
+	// RecordHAR writes a HAR 1.2 archive, which can be opened in browser developer tools and HAR viewers.
+	RecordHAR
+)
+
+// RecordedCall is a recorded request/response pair with redacted headers and bodies.
+type RecordedCall struct {
+	StartedAt     time.Time
+	Operation     string
+	ChannelID     int64
+	CorrelationID string
+	Attempt       int
+	Method        string
+	URL           string
+
+	RequestHeader http.Header
+	// RequestBody is the redacted JSON body, or a description of other bodies.
+	RequestBody string
+
+	// Status is 0 if no response was received.
+	Status         int
+	ResponseHeader http.Header
+	// ResponseBody is the redacted JSON body, or a description of other bodies.
+	ResponseBody string
+	// Error is the transport error of calls without a response.
+	Error string
+
+	// Duration is the time until the response headers are received or the call fails.
+	Duration time.Duration
+	Timings  RequestTimings
+}
+
+// Failed reports whether the call failed with a transport error or an error status code.
+func (c *RecordedCall) Failed() bool {
+	return c.Error != "" || c.Status >= http.StatusBadRequest
+}
+
+// RecordFilter decides whether a call is recorded.
+type RecordFilter func(call *RecordedCall) bool
+
+// RecordFailed returns a RecordFilter that records only failed calls.
+func RecordFailed() RecordFilter {
+	return func(call *RecordedCall) bool { return call.Failed() }
+}
+
+// RecordChannel returns a RecordFilter that records only the calls of the channel.
+func RecordChannel(channelID int64) RecordFilter {
+	return func(call *RecordedCall) bool { return call.ChannelID == channelID }
+}
+
+// RecorderSettings configures a TrafficRecorder.
+type RecorderSettings struct {
+	// Format is the output format. Default is RecordJSONL.
+	Format RecordFormat
+	// Filter decides which calls are recorded. Default is all calls.
+	Filter RecordFilter
+	// RedactHeaders are the redacted request and response headers. Default is DefaultRedactHeaders.
+	RedactHeaders []string
+	// RedactFields are the names of JSON object fields redacted at any depth. Default is DefaultRedactFields.
+	RedactFields []string
+	// RedactPaths are dot-separated paths of redacted JSON values, see DumpSettings.RedactPaths.
+	RedactPaths []string
+	// MaxBodySize is the maximum recorded body size in bytes. Larger bodies are not recorded. Default is 64 KiB.
+	MaxBodySize int
+}
+
+// TrafficRecorder writes the calls passed through the Recorder middleware to an io.Writer,
+// e.g. to attach exact exchanges to support tickets. It is safe for concurrent use.
+//
+// A HAR archive is complete only after Close. If the writer is a RotatingFile, every file
+// gets a complete archive, and files are rotated between calls only.
+type TrafficRecorder struct {
+	s        RecorderSettings
+	redactor *redactor
+
+	mu      sync.Mutex
+	w       io.Writer
+	started bool
+	err     error
+}
+
+// NewTrafficRecorder creates a TrafficRecorder writing to w.
+func NewTrafficRecorder(w io.Writer, s RecorderSettings) *TrafficRecorder {
+	return &TrafficRecorder{
+		s: s,
+		w: w,
+		redactor: newRedactor(DumpSettings{
+			RedactHeaders: s.RedactHeaders,
+			RedactFields:  s.RedactFields,
+			RedactPaths:   s.RedactPaths,
+			MaxBodySize:   s.MaxBodySize,
+		}),
+	}
+}
+
+// Recorder is a middleware that records each call with the TrafficRecorder:
+// its operation, redacted headers and bodies, status, duration and RequestTimings.
+// Write errors don't fail the calls; the first one is returned by TrafficRecorder.Close.
+func Recorder(rec *TrafficRecorder) Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			reqBody, err := peekRequestBody(req, rec.redactor.maxBody)
+			if err != nil {
+				return nil, err
+			}
+
+			req, timingsDone := withTimings(req)
+			call := &RecordedCall{
+				StartedAt:     time.Now(),
+				Operation:     unknownOperation,
+				Attempt:       AttemptFromContext(req.Context()),
+				Method:        req.Method,
+				URL:           req.URL.String(),
+				RequestHeader: rec.redactor.redactHeaders(req.Header),
+				RequestBody:   rec.redactor.dumpBody(reqBody, req.Header.Get("Content-Type")),
+			}
+			if op, ok := requestOperation(req); ok {
+				call.Operation = op.ID
+				call.ChannelID = op.ChannelID
+			}
+			call.CorrelationID, _ = CorrelationIDFromContext(req.Context())
+
+			resp, err := next.Do(req)
+			resp = timingsDone(resp)
+			call.Duration = time.Since(call.StartedAt)
+			call.Timings, _ = TimingsFromContext(req.Context())
+
+			if err != nil {
+				call.Error = err.Error()
+				rec.record(call)
+				return nil, err
+			}
+
+			call.Status = resp.StatusCode
+			call.ResponseHeader = rec.redactor.redactHeaders(resp.Header)
+
+			if resp.Body != nil {
+				prefix, err := readLimited(resp.Body, rec.redactor.maxBody)
+				if err != nil {
+					_ = resp.Body.Close()
+					call.Error = err.Error()
+					rec.record(call)
+					return nil, err
+				}
+				resp.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+
+				call.ResponseBody = rec.redactor.dumpBody(prefix, resp.Header.Get("Content-Type"))
+			}
+
+			rec.record(call)
+
+			return resp, nil
+		})
+	}
+}
+
+// Close finishes the HAR archive and closes the writer if it is an io.Closer.
+// It returns the first error that occurred while recording.
+func (r *TrafficRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.s.Format == RecordHAR && r.started {
+		r.write([]byte(harFooter))
+		r.started = false
+	}
+	if c, ok := r.w.(io.Closer); ok {
+		if err := c.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+
+	return r.err
+}
+
+func (r *TrafficRecorder) record(call *RecordedCall) {
+	if r.s.Filter != nil && !r.s.Filter(call) {
+		return
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if r.s.Format == RecordHAR {
+		data, err = json.Marshal(newHAREntry(call))
+	} else {
+		data, err = json.Marshal(newJSONLRecord(call))
+		data = append(data, '\n')
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		if r.err == nil {
+			r.err = err
+		}
+		return
+	}
+
+	if r.s.Format != RecordHAR {
+		r.write(data)
+		return
+	}
+
+	rf, rotating := r.w.(*RotatingFile)
+	if rotating && (!r.started && rf.size() > 0 || r.started && rf.exceeds(len(data)+len(harFooter)+1)) {
+		if r.started {
+			r.write([]byte(harFooter))
+		}
+		if err := rf.Rotate(); err != nil && r.err == nil {
+			r.err = err
+		}
+		r.started = false
+	}
+
+	if r.started {
+		r.write(append([]byte(","), data...))
+	} else {
+		r.write(append([]byte(harHeader), data...))
+		r.started = true
+	}
+}
+
+// write writes data, remembering the first error. The caller must hold r.mu.
+// HAR archives rotate a RotatingFile themselves, so that the header, entries and footer
+// are never split between files.
+func (r *TrafficRecorder) write(data []byte) {
+	var err error
+	if rf, ok := r.w.(*RotatingFile); ok && r.s.Format == RecordHAR {
+		_, err = rf.writeNoRotate(data)
+	} else {
+		_, err = r.w.Write(data)
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+type jsonlRecord struct {
+	StartedAt      time.Time   `json:"started_at"`
+	Operation      string      `json:"operation"`
+	ChannelID      int64       `json:"channel_id,omitempty"`
+	CorrelationID  string      `json:"correlation_id,omitempty"`
+	Attempt        int         `json:"attempt"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_headers"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"response_headers,omitempty"`
+	ResponseBody   string      `json:"response_body,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	DurationMs     float64     `json:"duration_ms"`
+	Timings        struct {
+		LimiterWaitMs float64 `json:"limiter_wait_ms"`
+		DNSMs         float64 `json:"dns_ms"`
+		ConnectMs     float64 `json:"connect_ms"`
+		TLSMs         float64 `json:"tls_ms"`
+		TTFBMs        float64 `json:"ttfb_ms"`
+		ConnReused    bool    `json:"conn_reused"`
+	} `json:"timings"`
+}
+
+func newJSONLRecord(c *RecordedCall) jsonlRecord {
+	r := jsonlRecord{
+		StartedAt:      c.StartedAt,
+		Operation:      c.Operation,
+		ChannelID:      c.ChannelID,
+		CorrelationID:  c.CorrelationID,
+		Attempt:        c.Attempt,
+		Method:         c.Method,
+		URL:            c.URL,
+		RequestHeader:  c.RequestHeader,
+		RequestBody:    c.RequestBody,
+		Status:         c.Status,
+		ResponseHeader: c.ResponseHeader,
+		ResponseBody:   c.ResponseBody,
+		Error:          c.Error,
+		DurationMs:     milliseconds(c.Duration),
+	}
+	r.Timings.LimiterWaitMs = milliseconds(c.Timings.LimiterWait)
+	r.Timings.DNSMs = milliseconds(c.Timings.DNS)
+	r.Timings.ConnectMs = milliseconds(c.Timings.Connect)
+	r.Timings.TLSMs = milliseconds(c.Timings.TLSHandshake)
+	r.Timings.TTFBMs = milliseconds(c.Timings.TimeToFirstByte)
+	r.Timings.ConnReused = c.Timings.ConnReused
+
+	return r
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+const (
+	harHeader = `{"log":{"version":"1.2","creator":{"name":"transport-api-client-go","version":"1.0"},"entries":[`
+	harFooter = "]}}\n"
+)
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// custom fields, prefixed with "_" as required by the HAR spec
+	Operation     string `json:"_operation"`
+	ChannelID     int64  `json:"_channelId,omitempty"`
+	CorrelationID string `json:"_correlationId,omitempty"`
+	Attempt       int    `json:"_attempt"`
+	Error         string `json:"_error,omitempty"`
+}
+
+func newHAREntry(c *RecordedCall) harEntry {
+	e := harEntry{
+		StartedDateTime: c.StartedAt.Format(time.RFC3339Nano),
+		Time:            milliseconds(c.Duration),
+		Request: harRequest{
+			Method:      c.Method,
+			URL:         c.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(c.RequestHeader),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(c.RequestBody),
+		},
+		Response: harResponse{
+			Status:      c.Status,
+			StatusText:  http.StatusText(c.Status),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(c.ResponseHeader),
+			Content: harContent{
+				Size:     len(c.ResponseBody),
+				MimeType: c.ResponseHeader.Get("Content-Type"),
+				Text:     c.ResponseBody,
+			},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings:       newHARTimings(c),
+		Operation:     c.Operation,
+		ChannelID:     c.ChannelID,
+		CorrelationID: c.CorrelationID,
+		Attempt:       c.Attempt,
+		Error:         c.Error,
+	}
+
+	if u, err := url.Parse(c.URL); err == nil {
+		for k, vs := range u.Query() {
+			for _, v := range vs {
+				e.Request.QueryString = append(e.Request.QueryString, harNameValue{Name: k, Value: v})
+			}
+		}
+		sort.Slice(e.Request.QueryString, func(i, j int) bool {
+			return e.Request.QueryString[i].Name < e.Request.QueryString[j].Name
+		})
+	}
+	if c.RequestBody != "" {
+		e.Request.PostData = &harPostData{
+			MimeType: c.RequestHeader.Get("Content-Type"),
+			Text:     c.RequestBody,
+		}
+	}
+
+	return e
+}
+
+// newHARTimings maps RequestTimings to HAR timings, where -1 means the phase does not apply
+// and connect includes the TLS handshake. The send and receive phases are not measured.
+func newHARTimings(c *RecordedCall) harTimings {
+	phase := func(d time.Duration) float64 {
+		if d <= 0 {
+			return -1
+		}
+		return milliseconds(d)
+	}
+
+	t := harTimings{
+		Blocked: phase(c.Timings.LimiterWait),
+		DNS:     phase(c.Timings.DNS),
+		Connect: phase(c.Timings.Connect + c.Timings.TLSHandshake),
+		SSL:     phase(c.Timings.TLSHandshake),
+		Wait:    milliseconds(c.Timings.TimeToFirstByte),
+	}
+	if t.Wait == 0 {
+		// the call failed before the first byte, or the timings were not recorded
+		t.Wait = milliseconds(c.Duration)
+	}
+
+	return t
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	headers := []harNameValue{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			headers = append(headers, harNameValue{Name: k, Value: v})
+		}
+	}
+
+	return headers
+}
@@ -0,0 +1,228 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderMiddleware(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/messages" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": ["invalid phone +79990000000"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id": 1, "avatar_url": "http://example.com/a.png"}]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	send := func(t *testing.T, c *ClientWithResponses) {
+		resp, err := c.SendMessageWithResponse(context.Background(), SendMessageJSONRequestBody{
+			Channel: 7,
+			Customer: &SendMessageRequestCustomer{
+				ExternalID: "c1",
+				Nickname:   "john",
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"invalid phone +79990000000"}, resp.JSONDefault.Errors, "response body is restored")
+	}
+
+	t.Run("calls are written as JSONL", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		rec := NewTrafficRecorder(&buf, RecorderSettings{})
+		c, err := NewClientWithResponses(srv.URL, WithMiddlewares(Recorder(rec)), WithTransportToken("secret-token"))
+		require.NoError(t, err)
+
+		send(t, c)
+		_, err = c.ListChannelsWithResponse(context.Background(), nil)
+		require.NoError(t, err)
+		require.NoError(t, rec.Close())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var sent map[string]any
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &sent))
+		require.Equal(t, "SendMessage", sent["operation"])
+		require.EqualValues(t, 7, sent["channel_id"])
+		require.EqualValues(t, 400, sent["status"])
+		require.Contains(t, sent, "duration_ms")
+		require.Contains(t, sent, "timings")
+		require.Contains(t, sent["request_body"], `"nickname":"[REDACTED]"`)
+		require.Contains(t, sent["response_body"], "invalid phone")
+
+		require.NotContains(t, buf.String(), "secret-token")
+		require.NotContains(t, buf.String(), "a.png")
+	})
+
+	t.Run("calls are written as HAR", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		limit := LimitQuery(1)
+		rec := NewTrafficRecorder(&buf, RecorderSettings{Format: RecordHAR})
+		c, err := NewClientWithResponses(srv.URL, WithMiddlewares(Recorder(rec)))
+		require.NoError(t, err)
+
+		send(t, c)
+		_, err = c.ListChannelsWithResponse(context.Background(), &ListChannelsParams{Limit: &limit})
+		require.NoError(t, err)
+		require.NoError(t, rec.Close())
+
+		var har struct {
+			Log struct {
+				Version string `json:"version"`
+				Entries []struct {
+					Request struct {
+						Method      string `json:"method"`
+						QueryString []struct {
+							Name  string `json:"name"`
+							Value string `json:"value"`
+						} `json:"queryString"`
+						PostData *struct {
+							MimeType string `json:"mimeType"`
+						} `json:"postData"`
+					} `json:"request"`
+					Response struct {
+						Status int `json:"status"`
+					} `json:"response"`
+					Operation string `json:"_operation"`
+				} `json:"entries"`
+			} `json:"log"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &har))
+		require.Equal(t, "1.2", har.Log.Version)
+		require.Len(t, har.Log.Entries, 2)
+
+		require.Equal(t, "SendMessage", har.Log.Entries[0].Operation)
+		require.Equal(t, 400, har.Log.Entries[0].Response.Status)
+		require.Equal(t, "application/json", har.Log.Entries[0].Request.PostData.MimeType)
+
+		require.Equal(t, "ListChannels", har.Log.Entries[1].Operation)
+		require.Equal(t, "limit", har.Log.Entries[1].Request.QueryString[0].Name)
+	})
+
+	t.Run("filters select recorded calls", func(t *testing.T) {
+		t.Parallel()
+
+		for name, filter := range map[string]RecordFilter{
+			"failed":  RecordFailed(),
+			"channel": RecordChannel(7),
+		} {
+			var buf bytes.Buffer
+			rec := NewTrafficRecorder(&buf, RecorderSettings{Filter: filter})
+			c, err := NewClientWithResponses(srv.URL, WithMiddlewares(Recorder(rec)))
+			require.NoError(t, err)
+
+			send(t, c)
+			_, err = c.ListChannelsWithResponse(context.Background(), nil)
+			require.NoError(t, err)
+
+			require.Equal(t, 1, strings.Count(buf.String(), "\n"), name)
+			require.Contains(t, buf.String(), `"operation":"SendMessage"`, name)
+		}
+	})
+
+	t.Run("transport errors are recorded", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		rec := NewTrafficRecorder(&buf, RecorderSettings{Filter: RecordFailed()})
+		doer := Recorder(rec)(DoerFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection reset")
+		}))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/channels", nil)
+		_, err := doer.Do(req)
+		require.Error(t, err)
+
+		require.Contains(t, buf.String(), `"error":"connection reset"`)
+	})
+
+	t.Run("large bodies are not buffered", func(t *testing.T) {
+		t.Parallel()
+
+		content := strings.Repeat("x", 1000)
+
+		var buf bytes.Buffer
+		rec := NewTrafficRecorder(&buf, RecorderSettings{MaxBodySize: 16})
+		doer := Recorder(rec)(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			require.Nil(t, req.GetBody)
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.Equal(t, content, string(body), "request body is restored")
+
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}))
+
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/files/upload", io.NopCloser(strings.NewReader(content)))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "body larger than 16 bytes")
+	})
+
+	t.Run("HAR archives are complete in every rotated file", func(t *testing.T) {
+		t.Parallel()
+
+		// 300 bytes is less than a single entry, so every entry goes to its own file
+		for _, maxSize := range []int64{1500, 300} {
+			path := filepath.Join(t.TempDir(), "calls.har")
+			f, err := NewRotatingFile(path, maxSize, 5)
+			require.NoError(t, err)
+
+			rec := NewTrafficRecorder(f, RecorderSettings{Format: RecordHAR})
+			c, err := NewClientWithResponses(srv.URL, WithMiddlewares(Recorder(rec)))
+			require.NoError(t, err)
+
+			for range 4 {
+				_, err = c.ListChannelsWithResponse(context.Background(), nil)
+				require.NoError(t, err)
+			}
+			require.NoError(t, rec.Close())
+
+			files, err := filepath.Glob(path + "*")
+			require.NoError(t, err)
+			require.Greater(t, len(files), 1)
+
+			entries := 0
+			for _, name := range files {
+				data, err := os.ReadFile(name)
+				require.NoError(t, err)
+
+				var har struct {
+					Log struct {
+						Version string            `json:"version"`
+						Entries []json.RawMessage `json:"entries"`
+					} `json:"log"`
+				}
+				require.NoError(t, json.Unmarshal(data, &har), name)
+				require.Equal(t, "1.2", har.Log.Version, name)
+				require.NotEmpty(t, har.Log.Entries, name)
+				entries += len(har.Log.Entries)
+			}
+			require.Equal(t, 4, entries, maxSize)
+			if maxSize == 300 {
+				require.Len(t, files, 4)
+			}
+		}
+	})
+}
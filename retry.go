@@ -0,0 +1,300 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures the Retry middleware.
+// Zero fields are replaced with the values from DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// MaxElapsedTime limits the total time spent on all attempts and delays.
+	// Zero means no limit besides the request context.
+	MaxElapsedTime time.Duration
+	// InitialInterval is the delay before the second attempt.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between attempts.
+	MaxInterval time.Duration
+	// MaxRetryAfter is the longest Retry-After delay to wait for. When a response asks
+	// for a longer delay, it is returned without further attempts.
+	MaxRetryAfter time.Duration
+	// Multiplier is applied to the delay after each attempt.
+	Multiplier float64
+	// Jitter randomizes each delay by up to the given fraction, e.g. 0.2 means ±20%.
+	Jitter float64
+
+	// ShouldRetry reports whether the attempt result is retryable.
+	// By default network errors and 429, 502, 503, 504 responses are retried.
+	ShouldRetry func(resp *http.Response, err error) bool
+	// IsIdempotent reports whether the request is safe to be sent more than once.
+	// By default only ListChannels, GetTemplates, GetFileUrl and SendMessage
+	// with message.external_id are retried.
+	IsIdempotent func(req *http.Request) bool
+	// OnRetry is called before waiting for the next attempt.
+	OnRetry func(ctx context.Context, attempt int, resp *http.Response, err error, delay time.Duration)
+}
+
+// DefaultRetryPolicy returns a policy with 3 attempts and exponential backoff from 100ms to 5s,
+// which waits for Retry-After delays up to 30s.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		MaxRetryAfter:   30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		ShouldRetry:     defaultShouldRetry,
+		IsIdempotent:    isIdempotentRequest,
+	}
+}
+
+// Retry is a middleware that retries failed idempotent requests with exponential backoff and jitter.
+// Retry-After headers of 429 and 503 responses are honored up to MaxRetryAfter. The request body is replayed
+// using req.GetBody, or buffered in memory if GetBody is not set and the request is idempotent.
+//
+// Middlewares passed after Retry to WithMiddlewares are called for each attempt
+// and can get the attempt number with AttemptFromContext.
+func Retry(policy RetryPolicy) Middleware {
+	policy = policy.withDefaults()
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := bufferJSONBody(req); err != nil {
+				return nil, err
+			}
+
+			if !policy.IsIdempotent(req) {
+				return next.Do(req)
+			}
+
+			if err := ensureGetBody(req); err != nil {
+				return nil, err
+			}
+
+			return policy.do(next, req)
+		})
+	}
+}
+
+func (p RetryPolicy) do(next HttpRequestDoer, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+	interval := p.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := requestForAttempt(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := next.Do(attemptReq)
+		if attempt >= p.MaxAttempts || ctx.Err() != nil || !p.ShouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := p.jitter(interval)
+		if retryAfter, ok := parseRetryAfter(resp); ok {
+			if retryAfter > p.MaxRetryAfter {
+				return resp, err
+			}
+			delay = retryAfter
+		}
+
+		if p.MaxElapsedTime > 0 && time.Since(start)+delay > p.MaxElapsedTime {
+			return resp, err
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(ctx, attempt, resp, err, delay)
+		}
+
+		drainBody(resp)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		interval = min(time.Duration(float64(interval)*p.Multiplier), p.MaxInterval)
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	def := DefaultRetryPolicy()
+
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = def.InitialInterval
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = def.MaxInterval
+	}
+	if p.MaxRetryAfter <= 0 {
+		p.MaxRetryAfter = def.MaxRetryAfter
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = def.Multiplier
+	}
+	if p.ShouldRetry == nil {
+		p.ShouldRetry = def.ShouldRetry
+	}
+	if p.IsIdempotent == nil {
+		p.IsIdempotent = def.IsIdempotent
+	}
+
+	return p
+}
+
+func (p RetryPolicy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return d
+	}
+
+	return time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+}
+
+// requestForAttempt returns a copy of the request with a fresh body and the attempt number in context.
+func requestForAttempt(req *http.Request, attempt int) (*http.Request, error) {
+	r := req.Clone(withAttempt(req.Context(), attempt))
+
+	if req.GetBody != nil && attempt > 1 {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	return r, nil
+}
+
+// ensureGetBody buffers the request body, if the request has no GetBody function.
+func ensureGetBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+
+	buf, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(buf))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+
+	return nil
+}
+
+func defaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isIdempotentRequest reports whether the request is safe to be retried.
+// SendMessage is idempotent only when the message has an external_id, which MG uses for deduplication.
+func isIdempotentRequest(req *http.Request) bool {
+	op, ok := requestOperation(req)
+	if !ok {
+		return req.Method == http.MethodGet || req.Method == http.MethodHead
+	}
+
+	return op.Idempotent
+}
+
+func hasMessageExternalID(req *http.Request) bool {
+	if req.GetBody == nil {
+		return false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	defer func() { _ = body.Close() }()
+
+	var msg struct {
+		Message struct {
+			ExternalID *string `json:"external_id"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(body).Decode(&msg); err != nil {
+		return false
+	}
+
+	return msg.Message.ExternalID != nil && *msg.Message.ExternalID != ""
+}
+
+// parseRetryAfter returns the delay from the Retry-After header of 429 and 503 responses.
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	return retryAfterDelay(resp.Header.Get("Retry-After"))
+}
+
+// retryAfterDelay parses the Retry-After header value in seconds or HTTP-date format.
+func retryAfterDelay(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+
+	return 0, false
+}
+
+func drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+}
+
+type ctxKeyAttempt struct{}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, ctxKeyAttempt{}, attempt)
+}
+
+// AttemptFromContext returns the attempt number set by the Retry middleware, or 1.
+func AttemptFromContext(ctx context.Context) int {
+	if v, ok := ctx.Value(ctxKeyAttempt{}).(int); ok {
+		return v
+	}
+	return 1
+}
@@ -0,0 +1,312 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fastRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+	}
+}
+
+func sequenceDoer(calls *atomic.Int32, statuses ...int) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		n := int(calls.Add(1)) - 1
+		status := statuses[min(n, len(statuses)-1)]
+
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Body:       http.NoBody,
+			Header:     make(http.Header),
+		}, nil
+	})
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("idempotent request is retried until success", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Retry(fastRetryPolicy())(sequenceDoer(&calls, 503, 502, 200))
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("last response is returned after max attempts", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Retry(fastRetryPolicy())(sequenceDoer(&calls, 503))
+		req, _ := http.NewRequest("GET", "http://example.com/templates", nil)
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 503, resp.StatusCode)
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("non-retryable status is not retried", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Retry(fastRetryPolicy())(sequenceDoer(&calls, 400, 200))
+		req, _ := http.NewRequest("GET", "http://example.com/files/uuid", nil)
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 400, resp.StatusCode)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("non-idempotent request is not retried", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		doer := Retry(fastRetryPolicy())(sequenceDoer(&calls, 503, 200))
+		req, _ := http.NewRequest("POST", "http://example.com/messages/ack", strings.NewReader(`{"channel": 1}`))
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 503, resp.StatusCode)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("bodies of requests that are not retried are not buffered", func(t *testing.T) {
+		t.Parallel()
+
+		file := io.NopCloser(strings.NewReader("file contents"))
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			require.Nil(t, req.GetBody)
+			require.Equal(t, file, req.Body)
+			return &http.Response{StatusCode: 503, Body: http.NoBody}, nil
+		})
+
+		req, _ := http.NewRequest("POST", "http://example.com/files/upload", file)
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		resp, err := Retry(fastRetryPolicy())(next).Do(req)
+		require.NoError(t, err)
+		require.Equal(t, 503, resp.StatusCode)
+	})
+
+	t.Run("SendMessage is retried only with external_id", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			body          string
+			expectedCalls int32
+		}{
+			{`{"channel": 1, "message": {"type": "text", "text": "hi"}}`, 1},
+			{`{"channel": 1, "message": {"type": "text", "external_id": ""}}`, 1},
+			{`{"channel": 1, "message": {"type": "text", "external_id": "ext-1"}}`, 2},
+		}
+
+		for _, tc := range testCases {
+			var calls atomic.Int32
+			var bodies []string
+
+			next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+				b, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				bodies = append(bodies, string(b))
+
+				return sequenceDoer(&calls, 503, 200).Do(req)
+			})
+
+			doer := Retry(fastRetryPolicy())(next)
+			req, _ := http.NewRequest("POST", "http://example.com/messages", io.NopCloser(strings.NewReader(tc.body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			_, err := doer.Do(req)
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedCalls, calls.Load(), tc.body)
+			for _, b := range bodies {
+				require.Equal(t, tc.body, b, "body must be replayed on each attempt")
+			}
+		}
+	})
+
+	t.Run("Retry-After header is honored", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if calls.Add(1) == 1 {
+				return &http.Response{
+					StatusCode: 429,
+					Body:       http.NoBody,
+					Header:     http.Header{"Retry-After": []string{"1"}},
+				}, nil
+			}
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})
+
+		var delays []time.Duration
+		policy := fastRetryPolicy()
+		policy.OnRetry = func(_ context.Context, _ int, _ *http.Response, _ error, delay time.Duration) {
+			delays = append(delays, delay)
+		}
+
+		doer := Retry(policy)(next)
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		start := time.Now()
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, []time.Duration{time.Second}, delays)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Retry-After beyond max elapsed time stops retries", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			return &http.Response{
+				StatusCode: 503,
+				Body:       http.NoBody,
+				Header:     http.Header{"Retry-After": []string{"60"}},
+			}, nil
+		})
+
+		policy := fastRetryPolicy()
+		policy.MaxElapsedTime = time.Second
+
+		doer := Retry(policy)(next)
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 503, resp.StatusCode)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("Retry-After beyond max retry after stops retries", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			return &http.Response{
+				StatusCode: 429,
+				Body:       http.NoBody,
+				Header:     http.Header{"Retry-After": []string{"86400"}},
+			}, nil
+		})
+
+		doer := Retry(DefaultRetryPolicy())(next)
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		start := time.Now()
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 429, resp.StatusCode)
+		require.Equal(t, int32(1), calls.Load())
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("network error is retried", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if calls.Add(1) < 3 {
+				return nil, errors.New("connection reset")
+			}
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})
+
+		doer := Retry(fastRetryPolicy())(next)
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("context cancellation stops waiting", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		policy := fastRetryPolicy()
+		policy.InitialInterval = time.Minute
+
+		doer := Retry(policy)(sequenceDoer(&calls, 503))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/channels", nil)
+
+		_, err := doer.Do(req)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("attempts are visible to logging", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		logger := NewDefaultLogger(log.New(&buf, "", 0))
+
+		var calls atomic.Int32
+		doer := Retry(fastRetryPolicy())(Logging(logger)(sequenceDoer(&calls, 503, 200)))
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		_, err := doer.Do(req)
+
+		require.NoError(t, err)
+
+		logs := buf.String()
+		require.Contains(t, logs, "HTTP GET http://example.com/channels - 503")
+		require.Contains(t, logs, "HTTP GET http://example.com/channels (attempt 2) - 200 OK")
+	})
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	t.Parallel()
+
+	d, ok := retryAfterDelay("3")
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, d)
+
+	d, ok = retryAfterDelay(time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat))
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Second, d, float64(2*time.Second))
+
+	_, ok = retryAfterDelay("soon")
+	require.False(t, ok)
+}
@@ -0,0 +1,167 @@
+package transport_api_client
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RotatingFile is an io.WriteCloser that appends to a file and rotates it when it exceeds MaxSize:
+// the file is renamed to "<path>.1", older files are shifted to "<path>.2" and so on,
+// and files above MaxBackups are removed. It is safe for concurrent use.
+//
+// Files are rotated between writes, so a single write is never split between files.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+}
+
+// NewRotatingFile opens or creates the file at path. maxSize is the size in bytes after which
+// the file is rotated, and maxBackups is the number of rotated files kept.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("rotating file: max size must be positive")
+	}
+
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write writes p to the file, rotating it first if p would make it exceed the maximum size.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.written > 0 && f.written+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	return f.write(p)
+}
+
+// writeNoRotate writes p to the file without rotating it, for writers that rotate the file
+// themselves with Rotate, e.g. to keep each file a complete document.
+func (f *RotatingFile) writeNoRotate(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	return f.write(p)
+}
+
+// write writes p to the current file. The caller must hold f.mu.
+func (f *RotatingFile) write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.written += int64(n)
+
+	return n, err
+}
+
+// Rotate closes the current file, shifts it to the backups and starts a new one.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	return f.rotate()
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// size returns the size of the current file.
+func (f *RotatingFile) size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.written
+}
+
+// exceeds reports whether writing n more bytes would make a non-empty file exceed the maximum size.
+func (f *RotatingFile) exceeds(n int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.written > 0 && f.written+int64(n) > f.maxSize
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.written = info.Size()
+
+	return nil
+}
+
+// rotate shifts the files and opens a new one. The caller must hold f.mu.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return f.open()
+	}
+
+	backup := func(i int) string { return f.path + "." + strconv.Itoa(i) }
+
+	if err := os.Remove(backup(f.maxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, backup(1)); err != nil {
+		return err
+	}
+
+	return f.open()
+}
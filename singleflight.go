@@ -0,0 +1,107 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Singleflight is a middleware that collapses concurrent identical GET requests into one upstream call.
+// Requests are identical if they have the same URL and transport token. Every caller receives
+// its own copy of the response with the whole body buffered in memory.
+//
+// A caller stops waiting when its own context is done. If the upstream call fails because
+// the context of the first caller is done, the other callers send their own requests.
+func Singleflight() Middleware {
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]*flightCall)
+	)
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet {
+				return next.Do(req)
+			}
+
+			key := req.URL.String() + "\n" + req.Header.Get(transportTokenHeader)
+
+			mu.Lock()
+			if c, ok := calls[key]; ok {
+				mu.Unlock()
+
+				select {
+				case <-c.done:
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+
+				if c.err != nil && isContextError(c.err) {
+					return next.Do(req)
+				}
+
+				return c.response(req)
+			}
+
+			c := &flightCall{done: make(chan struct{})}
+			calls[key] = c
+			mu.Unlock()
+
+			c.do(next, req)
+
+			mu.Lock()
+			delete(calls, key)
+			mu.Unlock()
+			close(c.done)
+
+			return c.response(req)
+		})
+	}
+}
+
+// flightCall is an upstream call shared by identical requests.
+type flightCall struct {
+	done chan struct{}
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+func (c *flightCall) do(next HttpRequestDoer, req *http.Request) {
+	resp, err := next.Do(req)
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	c.resp = resp
+	c.body = body
+}
+
+// response returns a copy of the shared response for the given request.
+func (c *flightCall) response(req *http.Request) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(c.body))
+	resp.Request = req
+
+	return &resp, nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,148 @@
+package transport_api_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleflightMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("identical concurrent requests share one call", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			<-release
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`[{"id": 1}]`)),
+			}, nil
+		})
+
+		doer := Singleflight()(next)
+
+		const n = 5
+		var wg sync.WaitGroup
+		bodies := make([]string, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", "http://example.com/channels?active=true", nil)
+				req.Header.Set("X-Transport-Token", "token")
+
+				resp, err := doer.Do(req)
+				require.NoError(t, err)
+				require.Same(t, req, resp.Request)
+
+				b, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+				bodies[i] = string(b)
+			}(i)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, int32(1), calls.Load())
+		for _, b := range bodies {
+			require.Equal(t, `[{"id": 1}]`, b)
+		}
+	})
+
+	t.Run("different tokens and non-GET requests are not collapsed", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			<-release
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})
+
+		doer := Singleflight()(next)
+
+		requests := []struct{ method, token string }{
+			{"GET", "token-1"},
+			{"GET", "token-2"},
+			{"POST", "token-1"},
+			{"POST", "token-1"},
+		}
+
+		var wg sync.WaitGroup
+		for _, r := range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest(r.method, "http://example.com/files/uuid", nil)
+				req.Header.Set("X-Transport-Token", r.token)
+				_, err := doer.Do(req)
+				require.NoError(t, err)
+			}()
+		}
+
+		require.Eventually(t, func() bool { return calls.Load() == 4 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("waiters send own request when the first caller is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(50 * time.Millisecond):
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			}
+		})
+
+		doer := Singleflight()(next)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/templates", nil)
+
+		done := make(chan error)
+		go func() {
+			_, err := doer.Do(first)
+			done <- err
+		}()
+
+		require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+		waiterDone := make(chan error)
+		go func() {
+			req, _ := http.NewRequest("GET", "http://example.com/templates", nil)
+			resp, err := doer.Do(req)
+			if err == nil {
+				require.Equal(t, 200, resp.StatusCode)
+			}
+			waiterDone <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		require.ErrorIs(t, <-done, context.Canceled)
+		require.NoError(t, <-waiterDone)
+		require.Equal(t, int32(2), calls.Load())
+	})
+}
@@ -0,0 +1,123 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrRequestTimeout is matched by the error returned when a request exceeds
+// the deadline set by the Timeout middleware. A deadline or cancellation
+// of the caller context does not match it.
+var ErrRequestTimeout = errors.New("request timeout")
+
+// TimeoutError is returned by the Timeout middleware when the operation deadline is exceeded.
+type TimeoutError struct {
+	// Operation is the API operation, e.g. "AckMessage", or the request method and path.
+	Operation string
+	// Duration is the applied operation timeout.
+	Duration time.Duration
+	// Err is the error returned by the transport.
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s timed out after %v: %v", ErrRequestTimeout, e.Operation, e.Duration, e.Err)
+}
+
+func (e *TimeoutError) Is(target error) bool { return target == ErrRequestTimeout }
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// Timeout implements the net.Error timeout check.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// TimeoutPolicy configures the Timeout middleware.
+type TimeoutPolicy struct {
+	// Default is the timeout of operations missing in Operations. Zero means no timeout.
+	Default time.Duration
+	// Operations configures timeouts by operation ID, e.g. "SendMessage" or "UploadFile".
+	Operations map[string]time.Duration
+}
+
+// DefaultTimeoutPolicy returns a policy with 30s timeout by default, 10s for acknowledgements
+// and read marks, and 2m for file uploads.
+func DefaultTimeoutPolicy() TimeoutPolicy {
+	return TimeoutPolicy{
+		Default: 30 * time.Second,
+		Operations: map[string]time.Duration{
+			"AckMessage":            10 * time.Second,
+			"MarkMessageRead":       10 * time.Second,
+			"MarkMessagesReadUntil": 10 * time.Second,
+			"UploadFile":            2 * time.Minute,
+			"UploadFileByUrl":       2 * time.Minute,
+		},
+	}
+}
+
+// Timeout is a middleware that applies a deadline to each request according to its operation.
+// A shorter deadline of the caller context always wins. When the operation deadline is exceeded,
+// the error matches ErrRequestTimeout; cancellation by the caller is returned as is.
+//
+// The deadline also covers reading the response body. Waiting in middlewares placed
+// before Timeout in WithMiddlewares (e.g. Limiter) is not counted in it.
+func Timeout(policy TimeoutPolicy) Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			name := operationName(req)
+
+			timeout, ok := policy.Operations[name]
+			if !ok {
+				timeout = policy.Default
+			}
+			if timeout <= 0 {
+				return next.Do(req)
+			}
+
+			parent := req.Context()
+			cause := &TimeoutError{Operation: name, Duration: timeout, Err: context.DeadlineExceeded}
+			ctx, cancel := context.WithTimeoutCause(parent, timeout, cause)
+
+			resp, err := next.Do(req.WithContext(ctx))
+			if err != nil {
+				cancel()
+				if parent.Err() == nil && context.Cause(ctx) == cause {
+					return nil, &TimeoutError{Operation: name, Duration: timeout, Err: err}
+				}
+				return nil, err
+			}
+
+			if resp.Body == nil {
+				cancel()
+				return resp, nil
+			}
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+
+			return resp, nil
+		})
+	}
+}
+
+// operationName returns the operation ID of the request, or its method and path for unknown operations.
+func operationName(req *http.Request) string {
+	if op, ok := requestOperation(req); ok {
+		return op.ID
+	}
+
+	return req.Method + " " + req.URL.Path
+}
+
+// cancelOnClose releases the request context when the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,137 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func slowDoer(delay time.Duration) HttpRequestDoer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}
+	})
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	t.Parallel()
+
+	policy := TimeoutPolicy{
+		Default: time.Second,
+		Operations: map[string]time.Duration{
+			"AckMessage": 20 * time.Millisecond,
+		},
+	}
+
+	t.Run("operation timeout is applied", func(t *testing.T) {
+		t.Parallel()
+
+		doer := Timeout(policy)(slowDoer(time.Second))
+		req, _ := http.NewRequest("POST", "http://example.com/messages/ack", nil)
+
+		start := time.Now()
+		_, err := doer.Do(req)
+
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+		require.ErrorIs(t, err, ErrRequestTimeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		require.Equal(t, "AckMessage", timeoutErr.Operation)
+		require.Equal(t, 20*time.Millisecond, timeoutErr.Duration)
+
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		require.True(t, netErr.Timeout())
+	})
+
+	t.Run("default timeout is applied to other operations", func(t *testing.T) {
+		t.Parallel()
+
+		doer := Timeout(policy)(slowDoer(50 * time.Millisecond))
+		req, _ := http.NewRequest("POST", "http://example.com/messages", nil)
+
+		resp, err := doer.Do(req)
+
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("shorter caller deadline wins", func(t *testing.T) {
+		t.Parallel()
+
+		doer := Timeout(policy)(slowDoer(time.Second))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "POST", "http://example.com/messages", nil)
+
+		_, err := doer.Do(req)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, errors.Is(err, ErrRequestTimeout))
+	})
+
+	t.Run("caller cancellation is not a timeout", func(t *testing.T) {
+		t.Parallel()
+
+		doer := Timeout(policy)(slowDoer(time.Second))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(5*time.Millisecond, cancel)
+		req, _ := http.NewRequestWithContext(ctx, "POST", "http://example.com/messages/ack", nil)
+
+		_, err := doer.Do(req)
+
+		require.ErrorIs(t, err, context.Canceled)
+		require.False(t, errors.Is(err, ErrRequestTimeout))
+	})
+
+	t.Run("context is alive until the body is closed", func(t *testing.T) {
+		t.Parallel()
+
+		var reqCtx context.Context
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			reqCtx = req.Context()
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})
+
+		doer := Timeout(policy)(next)
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, reqCtx.Err())
+
+		require.NoError(t, resp.Body.Close())
+		require.ErrorIs(t, reqCtx.Err(), context.Canceled)
+	})
+
+	t.Run("zero timeout disables the deadline", func(t *testing.T) {
+		t.Parallel()
+
+		var hasDeadline bool
+		next := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			_, hasDeadline = req.Context().Deadline()
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})
+
+		doer := Timeout(TimeoutPolicy{})(next)
+		req, _ := http.NewRequest("GET", "http://example.com/channels", nil)
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.False(t, hasDeadline)
+	})
+}
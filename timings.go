@@ -0,0 +1,195 @@
+package transport_api_client
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestTimings is the timing breakdown of a request. Phases that didn't happen are zero,
+// e.g. DNS, Connect and TLSHandshake of a request sent over a reused connection.
+type RequestTimings struct {
+	// LimiterWait is the time spent waiting in Limiter and KeyedLimiter.
+	LimiterWait time.Duration
+	// DNS is the duration of the host lookup.
+	DNS time.Duration
+	// Connect is the duration of establishing the TCP connection.
+	Connect time.Duration
+	// TLSHandshake is the duration of the TLS handshake.
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the time from writing the request to the first response byte,
+	// i.e. the server processing time plus the network round trip.
+	TimeToFirstByte time.Duration
+	// BodyRead is the time from receiving the response headers to the end of the body.
+	// It is known only after the body is read or closed.
+	BodyRead time.Duration
+	// ConnReused is true if the request was sent over a reused connection.
+	ConnReused bool
+}
+
+// Timings is a middleware that records the RequestTimings of requests using net/http/httptrace.
+// The timings are available to the next middlewares with TimingsFromContext, e.g. to log them
+// or to report them as metrics.
+//
+// Logging and Metrics record the timings themselves, so Timings is needed only to measure
+// the limiter wait of Limiter placed before them, or for custom middlewares.
+// Place it first in WithMiddlewares to cover all the others.
+func Timings() Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req, done := withTimings(req)
+			resp, err := next.Do(req)
+			return done(resp), err
+		})
+	}
+}
+
+// TimingsFromContext returns the timings recorded so far for the request of the context.
+// It returns false if the timings are not recorded, i.e. no Timings, Logging or Metrics
+// middleware is placed before the caller.
+func TimingsFromContext(ctx context.Context) (RequestTimings, bool) {
+	rec, ok := ctx.Value(ctxKeyTimings{}).(*timingsRecorder)
+	if !ok {
+		return RequestTimings{}, false
+	}
+
+	return rec.snapshot(), true
+}
+
+type ctxKeyTimings struct{}
+
+// withTimings starts recording the timings of the request, unless they are already recorded.
+// The returned function must be called with the response to measure the body read.
+func withTimings(req *http.Request) (*http.Request, func(*http.Response) *http.Response) {
+	if _, ok := req.Context().Value(ctxKeyTimings{}).(*timingsRecorder); ok {
+		return req, func(resp *http.Response) *http.Response { return resp }
+	}
+
+	rec := &timingsRecorder{}
+	ctx := context.WithValue(req.Context(), ctxKeyTimings{}, rec)
+	ctx = httptrace.WithClientTrace(ctx, rec.clientTrace())
+
+	return req.WithContext(ctx), rec.wrapResponse
+}
+
+// addLimiterWait adds the time spent waiting in a rate limiter to the timings of the request.
+func addLimiterWait(ctx context.Context, d time.Duration) {
+	if rec, ok := ctx.Value(ctxKeyTimings{}).(*timingsRecorder); ok {
+		rec.mu.Lock()
+		rec.timings.LimiterWait += d
+		rec.mu.Unlock()
+	}
+}
+
+// timingsRecorder collects RequestTimings from httptrace callbacks, which may be called
+// from different goroutines.
+type timingsRecorder struct {
+	mu       sync.Mutex
+	timings  RequestTimings
+	dnsStart time.Time
+	conStart time.Time
+	tlsStart time.Time
+	wrote    time.Time
+	headers  time.Time
+}
+
+func (r *timingsRecorder) snapshot() RequestTimings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.timings
+}
+
+func (r *timingsRecorder) update(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn()
+}
+
+func (r *timingsRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.update(func() { r.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.update(func() { r.timings.DNS = time.Since(r.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			r.update(func() {
+				if r.conStart.IsZero() {
+					r.conStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			r.update(func() {
+				if err == nil && r.timings.Connect == 0 {
+					r.timings.Connect = time.Since(r.conStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			r.update(func() { r.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.update(func() { r.timings.TLSHandshake = time.Since(r.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.update(func() { r.timings.ConnReused = info.Reused })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.update(func() { r.wrote = time.Now() })
+		},
+		GotFirstResponseByte: func() {
+			r.update(func() {
+				if !r.wrote.IsZero() {
+					r.timings.TimeToFirstByte = time.Since(r.wrote)
+				}
+			})
+		},
+	}
+}
+
+// wrapResponse measures reading of the response body.
+func (r *timingsRecorder) wrapResponse(resp *http.Response) *http.Response {
+	if resp == nil || resp.Body == nil {
+		return resp
+	}
+
+	r.update(func() { r.headers = time.Now() })
+	resp.Body = &timedBody{ReadCloser: resp.Body, recorder: r}
+
+	return resp
+}
+
+// timedBody records the body read duration on EOF or close, whichever happens first.
+type timedBody struct {
+	io.ReadCloser
+	recorder *timingsRecorder
+	once     sync.Once
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done()
+	return err
+}
+
+func (b *timedBody) done() {
+	b.once.Do(func() {
+		b.recorder.update(func() { b.recorder.timings.BodyRead = time.Since(b.recorder.headers) })
+	})
+}
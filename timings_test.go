@@ -0,0 +1,91 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type sleepingLimiter time.Duration
+
+func (l sleepingLimiter) Wait(context.Context) error {
+	time.Sleep(time.Duration(l))
+	return nil
+}
+
+func TestTimingsMiddleware(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("phases are recorded", func(t *testing.T) {
+		t.Parallel()
+
+		var ctx context.Context
+		capture := func(next HttpRequestDoer) HttpRequestDoer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				ctx = req.Context()
+				return next.Do(req)
+			})
+		}
+
+		doer := WithMiddlewares(Timings(), Limiter(sleepingLimiter(10*time.Millisecond)), capture)
+		c := &Client{Server: srv.URL, Client: &http.Client{Transport: &http.Transport{}}}
+		require.NoError(t, doer(c))
+
+		req, _ := http.NewRequest("GET", srv.URL+"/channels", nil)
+		resp, err := c.Client.Do(req)
+		require.NoError(t, err)
+
+		timings, ok := TimingsFromContext(ctx)
+		require.True(t, ok)
+		require.GreaterOrEqual(t, timings.LimiterWait, 10*time.Millisecond)
+		require.Greater(t, timings.Connect, time.Duration(0))
+		require.False(t, timings.ConnReused)
+		require.GreaterOrEqual(t, timings.TimeToFirstByte, 20*time.Millisecond)
+		require.Zero(t, timings.BodyRead)
+
+		readBody(t, resp)
+
+		timings, _ = TimingsFromContext(ctx)
+		require.Greater(t, timings.BodyRead, time.Duration(0))
+	})
+
+	t.Run("timings are logged and reported as metrics", func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		metrics := newFakeMetricsRecorder()
+
+		c, err := NewClient(srv.URL, WithMiddlewares(
+			Timings(),
+			Metrics(metrics),
+			Logging(NewDefaultLogger(log.New(&buf, "", 0))),
+			Limiter(sleepingLimiter(10*time.Millisecond)),
+		))
+		require.NoError(t, err)
+
+		resp, err := c.ListChannels(context.Background(), nil)
+		require.NoError(t, err)
+		readBody(t, resp)
+
+		require.Regexp(t, `\(took .+; limiter .+, ttfb .+\)`, buf.String())
+		require.Len(t, metrics.timings, 1)
+		timings := metrics.timings[0]
+		require.Greater(t, timings.LimiterWait, time.Duration(0))
+		require.Greater(t, timings.Connect, time.Duration(0))
+		require.Greater(t, timings.TimeToFirstByte, time.Duration(0))
+		require.Greater(t, timings.BodyRead, time.Duration(0))
+	})
+}
@@ -0,0 +1,237 @@
+package transport_api_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoToken is returned by a TokenProvider that has no token.
+var ErrNoToken = errors.New("transport token is not set")
+
+// TokenProvider resolves the transport token of a request.
+// Implementations must be safe for concurrent use.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenInvalidator is implemented by a TokenProvider that caches tokens.
+// InvalidateToken drops the token if it is still cached, so that the next Token call resolves a new one.
+type TokenInvalidator interface {
+	InvalidateToken(token string)
+}
+
+// TokenFunc adapts a function, e.g. a secret store lookup, to a TokenProvider.
+type TokenFunc func(ctx context.Context) (string, error)
+
+func (f TokenFunc) Token(ctx context.Context) (string, error) { return f(ctx) }
+
+// WithTokenProvider resolves the transport token of each request with p, so that tokens
+// can be rotated without rebuilding the client. The token is set before the middlewares run.
+//
+// If the Message Gateway responds with 401, a token cached by p is invalidated, see TokenInvalidator,
+// and the request is retried once if p returns a different token.
+func WithTokenProvider(p TokenProvider) ClientOption {
+	return func(c *Client) error {
+		if err := WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+			token, err := p.Token(ctx)
+			if err != nil {
+				return err
+			}
+			req.Header.Set(transportTokenHeader, token)
+
+			return nil
+		})(c); err != nil {
+			return err
+		}
+
+		if c.Client == nil {
+			c.Client = &http.Client{}
+		}
+		c.Client = refreshTokenOnUnauthorized(p)(c.Client)
+
+		return nil
+	}
+}
+
+// refreshTokenOnUnauthorized retries a request rejected with 401 once with a new token.
+// Only JSON bodies are buffered for the retry: requests with other bodies that have no GetBody,
+// e.g. file uploads, are not retried, but the rejected token is still invalidated.
+func refreshTokenOnUnauthorized(p TokenProvider) Middleware {
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := bufferJSONBody(req); err != nil {
+				return nil, err
+			}
+
+			resp, err := next.Do(req)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+
+			rejected := req.Header.Get(transportTokenHeader)
+			if inv, ok := p.(TokenInvalidator); ok {
+				inv.InvalidateToken(rejected)
+			}
+
+			replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+			if !replayable {
+				return resp, nil
+			}
+
+			token, tokenErr := p.Token(req.Context())
+			if tokenErr != nil || token == rejected {
+				return resp, nil
+			}
+
+			retry := req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return resp, nil
+				}
+				retry.Body = body
+			}
+			retry.Header.Set(transportTokenHeader, token)
+
+			drainBody(resp)
+
+			return next.Do(retry)
+		})
+	}
+}
+
+// StaticToken returns a TokenProvider with a fixed token.
+func StaticToken(token string) TokenProvider {
+	return TokenFunc(func(context.Context) (string, error) {
+		if token == "" {
+			return "", ErrNoToken
+		}
+		return token, nil
+	})
+}
+
+type ctxKeyToken struct{}
+
+// WithToken returns a new context with the transport token for ContextToken.
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, ctxKeyToken{}, token)
+}
+
+// ContextToken returns a TokenProvider that takes the token from the request context, see WithToken,
+// e.g. to serve several channels with one client. Requests without a token in the context
+// get the token of fallback, or ErrNoToken if fallback is nil.
+func ContextToken(fallback TokenProvider) TokenProvider {
+	return TokenFunc(func(ctx context.Context) (string, error) {
+		if token, ok := ctx.Value(ctxKeyToken{}).(string); ok && token != "" {
+			return token, nil
+		}
+		if fallback == nil {
+			return "", ErrNoToken
+		}
+		return fallback.Token(ctx)
+	})
+}
+
+// EnvToken returns a TokenProvider that reads the token from the environment variable on every request.
+func EnvToken(name string) TokenProvider {
+	return TokenFunc(func(context.Context) (string, error) {
+		if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+			return token, nil
+		}
+		return "", ErrNoToken
+	})
+}
+
+type fileToken struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+// FileToken returns a TokenProvider that reads the token from a file, e.g. a mounted Kubernetes secret.
+// The file is read again when its modification time or size changes.
+func FileToken(path string) TokenProvider {
+	return &fileToken{path: path}
+}
+
+func (f *fileToken) Token(context.Context) (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	token := string(bytes.TrimSpace(data))
+	if token == "" {
+		return "", ErrNoToken
+	}
+
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+
+	return token, nil
+}
+
+type cachedToken struct {
+	p   TokenProvider
+	ttl time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// CachedToken returns a TokenProvider that caches the token of p for ttl, e.g. to avoid
+// calling a secret store for every request. Concurrent requests wait for one call to p.
+// The cached token is dropped on 401, see TokenInvalidator.
+//
+// Don't cache providers that depend on the context, such as ContextToken.
+func CachedToken(p TokenProvider, ttl time.Duration) TokenProvider {
+	return &cachedToken{p: p, ttl: ttl}
+}
+
+func (c *cachedToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	token, err := c.p.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.token, c.expiresAt = token, time.Now().Add(c.ttl)
+
+	return token, nil
+}
+
+func (c *cachedToken) InvalidateToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token = ""
+	}
+}
@@ -0,0 +1,224 @@
+package transport_api_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenProvider(t *testing.T) {
+	t.Parallel()
+
+	t.Run("token is resolved per request", func(t *testing.T) {
+		t.Parallel()
+
+		var tokens []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokens = append(tokens, r.Header.Get(transportTokenHeader))
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		t.Cleanup(srv.Close)
+
+		c, err := NewClient(srv.URL, WithTokenProvider(ContextToken(StaticToken("default"))))
+		require.NoError(t, err)
+
+		for _, ctx := range []context.Context{context.Background(), WithToken(context.Background(), "channel-token")} {
+			resp, err := c.ListChannels(ctx, nil)
+			require.NoError(t, err)
+			readBody(t, resp)
+		}
+
+		require.Equal(t, []string{"default", "channel-token"}, tokens)
+	})
+
+	t.Run("middlewares see the token", func(t *testing.T) {
+		t.Parallel()
+
+		var seen string
+		capture := func(next HttpRequestDoer) HttpRequestDoer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				seen = req.Header.Get(transportTokenHeader)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})
+		}
+
+		c, err := NewClient("http://example.com", WithMiddlewares(capture), WithTokenProvider(StaticToken("token")))
+		require.NoError(t, err)
+
+		_, err = c.ListChannels(context.Background(), nil)
+		require.NoError(t, err)
+		require.Equal(t, "token", seen)
+	})
+
+	t.Run("provider error fails the request", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := NewClient("http://example.com", WithTokenProvider(EnvToken("MG_TEST_TOKEN_NOT_SET")))
+		require.NoError(t, err)
+
+		_, err = c.ListChannels(context.Background(), nil)
+		require.ErrorIs(t, err, ErrNoToken)
+	})
+
+	t.Run("rejected token is refreshed and the request is retried once", func(t *testing.T) {
+		t.Parallel()
+
+		const valid = "new"
+		var (
+			mu    sync.Mutex
+			calls []string
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			token := r.Header.Get(transportTokenHeader)
+			calls = append(calls, token)
+			if token != valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"errors": ["invalid token"]}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"message_id": 1}`))
+		}))
+		t.Cleanup(srv.Close)
+
+		var store atomic.Value
+		store.Store("old")
+		var lookups atomic.Int32
+		p := CachedToken(TokenFunc(func(context.Context) (string, error) {
+			lookups.Add(1)
+			return store.Load().(string), nil
+		}), time.Hour)
+
+		c, err := NewClientWithResponses(srv.URL, WithTokenProvider(p))
+		require.NoError(t, err)
+
+		send := func() *SendMessageResp {
+			resp, err := c.SendMessageWithResponse(context.Background(), SendMessageJSONRequestBody{Channel: 1})
+			require.NoError(t, err)
+			return resp
+		}
+
+		// the store still has the old token, so the request is not retried
+		require.Equal(t, http.StatusUnauthorized, send().StatusCode())
+		require.Equal(t, []string{"old"}, calls)
+
+		// the token is rotated in the store, and the cached one is refreshed on 401
+		store.Store("new")
+		calls = nil
+		lookups.Store(0)
+		require.Equal(t, int64(1), send().JSON200.MessageID)
+		require.Equal(t, []string{"old", "new"}, calls)
+		require.EqualValues(t, 1, lookups.Load())
+
+		// the new token is cached
+		calls = nil
+		require.Equal(t, int64(1), send().JSON200.MessageID)
+		require.Equal(t, []string{"new"}, calls)
+		require.EqualValues(t, 1, lookups.Load())
+	})
+}
+
+func TestRefreshTokenOnUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uploads are not buffered nor retried", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			calls       atomic.Int32
+			invalidated atomic.Bool
+		)
+		p := &invalidatingToken{TokenProvider: StaticToken("new"), invalidated: &invalidated}
+		file := io.NopCloser(strings.NewReader("file contents"))
+		doer := refreshTokenOnUnauthorized(p)(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			require.Nil(t, req.GetBody)
+			require.Equal(t, file, req.Body)
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+		}))
+
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/files/upload", file)
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+		req.Header.Set(transportTokenHeader, "old")
+
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.EqualValues(t, 1, calls.Load())
+		require.True(t, invalidated.Load(), "the rejected token is invalidated for the next requests")
+	})
+}
+
+type invalidatingToken struct {
+	TokenProvider
+	invalidated *atomic.Bool
+}
+
+func (p *invalidatingToken) InvalidateToken(string) { p.invalidated.Store(true) }
+
+func TestFileToken(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	p := FileToken(path)
+
+	token, err := p.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "first", token)
+
+	require.NoError(t, os.WriteFile(path, []byte("second-token\n"), 0o600))
+
+	token, err = p.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "second-token", token)
+
+	require.NoError(t, os.WriteFile(path, []byte(" \n"), 0o600))
+
+	_, err = p.Token(context.Background())
+	require.ErrorIs(t, err, ErrNoToken)
+}
+
+func TestCachedToken(t *testing.T) {
+	t.Parallel()
+
+	var lookups atomic.Int32
+	p := CachedToken(TokenFunc(func(context.Context) (string, error) {
+		lookups.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return "token", nil
+	}), time.Hour)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			token, err := p.Token(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "token", token)
+		})
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, lookups.Load())
+
+	p.(TokenInvalidator).InvalidateToken("other")
+	_, _ = p.Token(context.Background())
+	require.EqualValues(t, 1, lookups.Load(), "other tokens don't invalidate the cache")
+
+	p.(TokenInvalidator).InvalidateToken("token")
+	_, _ = p.Token(context.Background())
+	require.EqualValues(t, 2, lookups.Load())
+}
@@ -0,0 +1,103 @@
+package transport_api_client
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/retailcrm/transport-api-client-go"
+
+// TracingSettings configures the Tracing middleware.
+type TracingSettings struct {
+	// TracerProvider creates the tracer. Default is the global provider,
+	// which is a no-op unless set with otel.SetTracerProvider.
+	TracerProvider trace.TracerProvider
+	// Propagator injects the trace context into request headers. Default is W3C Trace Context.
+	Propagator propagation.TextMapPropagator
+}
+
+// Tracing is a middleware that starts a client span for each request and injects
+// the traceparent header. Spans are named after the API operation, e.g. "SendMessage",
+// or after the request method for unknown operations.
+//
+// Spans have the HTTP method, URL, response status, channel ID and, for failed requests,
+// the error type and the errors of ErrorResponse as attributes.
+// A span ends when the response body is closed.
+func Tracing(s TracingSettings) Middleware {
+	if s.TracerProvider == nil {
+		s.TracerProvider = otel.GetTracerProvider()
+	}
+	if s.Propagator == nil {
+		s.Propagator = propagation.TraceContext{}
+	}
+
+	tracer := s.TracerProvider.Tracer(tracerName)
+
+	return func(next HttpRequestDoer) HttpRequestDoer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := bufferJSONBody(req); err != nil {
+				return nil, err
+			}
+
+			name := req.Method
+			attrs := []attribute.KeyValue{
+				attribute.String("http.request.method", req.Method),
+				attribute.String("url.full", req.URL.String()),
+				attribute.String("server.address", req.URL.Hostname()),
+			}
+			if op, ok := requestOperation(req); ok {
+				name = op.ID
+				attrs = append(attrs, attribute.String("mg.operation", op.ID))
+				if op.ChannelID != 0 {
+					attrs = append(attrs, attribute.Int64("mg.channel_id", op.ChannelID))
+				}
+			}
+			if attempt := AttemptFromContext(req.Context()); attempt > 1 {
+				attrs = append(attrs, attribute.Int("http.request.resend_count", attempt-1))
+			}
+
+			ctx, span := tracer.Start(req.Context(), name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+			)
+
+			req = req.WithContext(ctx)
+			req.Header = req.Header.Clone()
+			s.Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+			resp, err := next.Do(req)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.SetAttributes(attribute.String("error.type", fmt.Sprintf("%T", err)))
+				span.End()
+				return nil, err
+			}
+
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+			if resp.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, resp.Status)
+				span.SetAttributes(attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+				if errs := responseErrors(resp); len(errs) > 0 {
+					span.SetAttributes(attribute.StringSlice("mg.errors", errs))
+				}
+			}
+
+			if resp.Body == nil {
+				span.End()
+				return resp, nil
+			}
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: func() { span.End() }}
+
+			return resp, nil
+		})
+	}
+}
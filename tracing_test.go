@@ -0,0 +1,183 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer records started spans, while propagating the parent span context as the noop tracer does.
+type recordingTracer struct {
+	noop.TracerProvider
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (p *recordingTracer) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracerImpl{provider: p}
+}
+
+type recordingTracerImpl struct {
+	noop.Tracer
+	provider *recordingTracer
+}
+
+func (t recordingTracerImpl) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, parent := t.Tracer.Start(ctx, name, opts...)
+
+	span := &recordingSpan{Span: parent, name: name, attrs: map[attribute.Key]attribute.Value{}}
+	cfg := trace.NewSpanStartConfig(opts...)
+	span.SetAttributes(cfg.Attributes()...)
+
+	t.provider.mu.Lock()
+	t.provider.spans = append(t.provider.spans, span)
+	t.provider.mu.Unlock()
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordingSpan struct {
+	trace.Span
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *recordingSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+func TestTracingMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("span is named after operation", func(t *testing.T) {
+		t.Parallel()
+
+		tp := &recordingTracer{}
+		doer := Tracing(TracingSettings{TracerProvider: tp})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+		}))
+
+		req, _ := http.NewRequest("PUT", "http://example.com/api/transport/v1/channels/42", strings.NewReader(`{}`))
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+
+		require.Len(t, tp.spans, 1)
+		span := tp.spans[0]
+		require.Equal(t, "UpdateChannel", span.name)
+		require.Equal(t, int64(42), span.attrs["mg.channel_id"].AsInt64())
+		require.Equal(t, int64(200), span.attrs["http.response.status_code"].AsInt64())
+		require.Equal(t, codes.Unset, span.status)
+		require.False(t, span.ended, "span ends when the body is closed")
+
+		require.NoError(t, resp.Body.Close())
+		require.True(t, span.ended)
+	})
+
+	t.Run("upload bodies are not buffered", func(t *testing.T) {
+		t.Parallel()
+
+		tp := &recordingTracer{}
+		file := io.NopCloser(strings.NewReader("file contents"))
+		doer := Tracing(TracingSettings{TracerProvider: tp})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			require.Nil(t, req.GetBody)
+			require.Equal(t, file, req.Body)
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}))
+
+		req, _ := http.NewRequest("POST", "http://example.com/api/transport/v1/files/upload", file)
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, "UploadFile", tp.spans[0].name)
+	})
+
+	t.Run("error response is recorded", func(t *testing.T) {
+		t.Parallel()
+
+		tp := &recordingTracer{}
+		doer := Tracing(TracingSettings{TracerProvider: tp})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 400,
+				Status:     "400 Bad Request",
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"errors": ["invalid channel"]}`)),
+			}, nil
+		}))
+
+		req, _ := http.NewRequest("POST", "http://example.com/messages", strings.NewReader(`{"channel": 7}`))
+		resp, err := doer.Do(req)
+		require.NoError(t, err)
+
+		span := tp.spans[0]
+		require.Equal(t, "SendMessage", span.name)
+		require.Equal(t, int64(7), span.attrs["mg.channel_id"].AsInt64())
+		require.Equal(t, codes.Error, span.status)
+		require.Equal(t, "400", span.attrs["error.type"].AsString())
+		require.Equal(t, []string{"invalid channel"}, span.attrs["mg.errors"].AsStringSlice())
+
+		parsed, err := ParseSendMessageResp(resp)
+		require.NoError(t, err)
+		require.Equal(t, []string{"invalid channel"}, parsed.JSONDefault.Errors)
+	})
+
+	t.Run("transport error is recorded", func(t *testing.T) {
+		t.Parallel()
+
+		tp := &recordingTracer{}
+		doer := Tracing(TracingSettings{TracerProvider: tp})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		}))
+
+		req, _ := http.NewRequest("GET", "http://example.com/unknown/path", nil)
+		_, err := doer.Do(req)
+		require.Error(t, err)
+
+		span := tp.spans[0]
+		require.Equal(t, "GET", span.name)
+		require.Equal(t, codes.Error, span.status)
+		require.True(t, span.ended)
+	})
+
+	t.Run("traceparent is injected", func(t *testing.T) {
+		t.Parallel()
+
+		var traceparent string
+		doer := Tracing(TracingSettings{})(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("traceparent")
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}))
+
+		traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+		spanID, _ := trace.SpanIDFromHex("0102030405060708")
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}))
+
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/channels", nil)
+		_, err := doer.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01", traceparent)
+		require.Empty(t, req.Header.Get("traceparent"), "caller request is not modified")
+	})
+}
@@ -0,0 +1,171 @@
+package transport_api_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxWebhookBodySize is the maximum size of a webhook request body.
+const maxWebhookBodySize = 10 << 20
+
+// WebhookHandlers are the callbacks of WebhookHandler, one per event type.
+// Events without a callback are acknowledged with an empty response.
+//
+// A callback error is returned to the Message Gateway with 500 status code, or with the status code
+// of a *WebhookError. Failed message deliveries are reported with 200 status code and
+// WebhookSendMessageResponseData.Error instead.
+type WebhookHandlers struct {
+	OnMessageSent    func(ctx context.Context, event WebhookMessageSent) (WebhookSendMessageResponseData, error)
+	OnMessageUpdated func(ctx context.Context, event WebhookMessageUpdated) error
+	OnMessageDeleted func(ctx context.Context, event WebhookMessageDeleted) error
+	OnMessageRead    func(ctx context.Context, event WebhookMessageRead) error
+	OnReactionAdd    func(ctx context.Context, event WebhookMessageReactionAdd) error
+	OnReactionDelete func(ctx context.Context, event WebhookMessageReactionDelete) error
+	OnTemplateCreate func(ctx context.Context, event WebhookTemplateCreate) (WebhookTemplateCreateResponseData, error)
+	OnTemplateUpdate func(ctx context.Context, event WebhookTemplateUpdate) error
+	OnTemplateDelete func(ctx context.Context, event WebhookTemplateDelete) error
+}
+
+// WebhookError is a callback error with the status code of the webhook response.
+// Status codes outside the 400-599 range are replaced with 500, so that an error is never reported
+// to the Message Gateway as a success.
+type WebhookError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *WebhookError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	if text := http.StatusText(e.StatusCode); text != "" {
+		return text
+	}
+
+	return "webhook error"
+}
+
+func (e *WebhookError) Unwrap() error { return e.Err }
+
+// WebhookHandler returns an http.Handler for the Message Gateway webhooks. It decodes WebhookRequestData,
+// calls the callback of the event type with the typed event, and responds with the WebhookResponse
+// of the event: WebhookSendMessageResponseData for message_sent, WebhookTemplateCreateResponseData
+// for template_create, and an empty object for the others.
+//
+// Invalid requests get 400 status code, and errors are returned as an ErrorResponse.
+// Wrap the handler with CorrelationHandler to read the correlation ID of webhooks in the callbacks.
+func WebhookHandler(h WebhookHandlers) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeWebhookError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		var req WebhookRequestData
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize)).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeWebhookError(w, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			writeWebhookError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook request: %w", err))
+			return
+		}
+
+		event, err := req.ValueByDiscriminator()
+		if err != nil {
+			writeWebhookError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook request: %w", err))
+			return
+		}
+
+		resp, err := h.dispatch(r.Context(), event)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var webhookErr *WebhookError
+			if errors.As(err, &webhookErr) && webhookErr.StatusCode >= 400 && webhookErr.StatusCode <= 599 {
+				status = webhookErr.StatusCode
+			}
+			writeWebhookError(w, status, err)
+			return
+		}
+
+		body, err := json.Marshal(resp)
+		if err != nil {
+			writeWebhookError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	})
+}
+
+// dispatch calls the callback of the event and returns its response.
+func (h WebhookHandlers) dispatch(ctx context.Context, event any) (WebhookResponse, error) {
+	var (
+		resp WebhookResponse
+		err  error
+	)
+
+	switch e := event.(type) {
+	case WebhookMessageSent:
+		if h.OnMessageSent != nil {
+			var data WebhookSendMessageResponseData
+			if data, err = h.OnMessageSent(ctx, e); err == nil {
+				err = resp.FromWebhookSendMessageResponseData(data)
+			}
+			return resp, err
+		}
+	case WebhookTemplateCreate:
+		if h.OnTemplateCreate != nil {
+			var data WebhookTemplateCreateResponseData
+			if data, err = h.OnTemplateCreate(ctx, e); err == nil {
+				err = resp.FromWebhookTemplateCreateResponseData(data)
+			}
+			return resp, err
+		}
+	case WebhookMessageUpdated:
+		err = callWebhook(ctx, h.OnMessageUpdated, e)
+	case WebhookMessageDeleted:
+		err = callWebhook(ctx, h.OnMessageDeleted, e)
+	case WebhookMessageRead:
+		err = callWebhook(ctx, h.OnMessageRead, e)
+	case WebhookMessageReactionAdd:
+		err = callWebhook(ctx, h.OnReactionAdd, e)
+	case WebhookMessageReactionDelete:
+		err = callWebhook(ctx, h.OnReactionDelete, e)
+	case WebhookTemplateUpdate:
+		err = callWebhook(ctx, h.OnTemplateUpdate, e)
+	case WebhookTemplateDelete:
+		err = callWebhook(ctx, h.OnTemplateDelete, e)
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	err = resp.FromWebhookEmptyResponse(struct{}{})
+
+	return resp, err
+}
+
+// callWebhook calls a callback without a response, if it is set.
+func callWebhook[E any](ctx context.Context, fn func(context.Context, E) error, event E) error {
+	if fn == nil {
+		return nil
+	}
+
+	return fn(ctx, event)
+}
+
+func writeWebhookError(w http.ResponseWriter, status int, err error) {
+	body, _ := json.Marshal(ErrorResponse{Errors: []string{err.Error()}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,126 @@
+package transport_api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	t.Parallel()
+
+	externalMessageID := "ext-1"
+	handler := WebhookHandler(WebhookHandlers{
+		OnMessageSent: func(_ context.Context, e WebhookMessageSent) (WebhookSendMessageResponseData, error) {
+			if e.Data.ChannelID == 0 {
+				return WebhookSendMessageResponseData{}, &WebhookError{StatusCode: http.StatusUnprocessableEntity, Err: errors.New("unknown channel")}
+			}
+			return WebhookSendMessageResponseData{ExternalMessageID: &externalMessageID}, nil
+		},
+		OnTemplateCreate: func(_ context.Context, e WebhookTemplateCreate) (WebhookTemplateCreateResponseData, error) {
+			return WebhookTemplateCreateResponseData{Code: e.Data.Name + "_" + e.Data.Lang}, nil
+		},
+		OnMessageRead: func(context.Context, WebhookMessageRead) error {
+			return errors.New("database is down")
+		},
+	})
+
+	for name, tc := range map[string]struct {
+		method string
+		body   string
+		status int
+		resp   string
+	}{
+		"message sent": {
+			body:   `{"type": "message_sent", "meta": {"timestamp": 1}, "data": {"channel_id": 1, "external_chat_id": "chat", "type": "text"}}`,
+			status: http.StatusOK,
+			resp:   `{"async": false, "external_message_id": "ext-1"}`,
+		},
+		"template create": {
+			body:   `{"type": "template_create", "meta": {"timestamp": 1}, "data": {"channel_id": 1, "name": "hello", "lang": "en"}}`,
+			status: http.StatusOK,
+			resp:   `{"code": "hello_en"}`,
+		},
+		"event without callback": {
+			body:   `{"type": "message_deleted", "meta": {"timestamp": 1}, "data": {"channel_id": 1}}`,
+			status: http.StatusOK,
+			resp:   `{}`,
+		},
+		"callback error": {
+			body:   `{"type": "message_read", "meta": {"timestamp": 1}, "data": {"channel_id": 1}}`,
+			status: http.StatusInternalServerError,
+			resp:   `{"errors": ["database is down"]}`,
+		},
+		"callback error with status": {
+			body:   `{"type": "message_sent", "meta": {"timestamp": 1}, "data": {"channel_id": 0}}`,
+			status: http.StatusUnprocessableEntity,
+			resp:   `{"errors": ["unknown channel"]}`,
+		},
+		"invalid JSON": {
+			body:   `{"type": `,
+			status: http.StatusBadRequest,
+			resp:   `{"errors": ["invalid webhook request: unexpected EOF"]}`,
+		},
+		"unknown type": {
+			body:   `{"type": "chat_closed", "meta": {"timestamp": 1}, "data": {}}`,
+			status: http.StatusBadRequest,
+			resp:   `{"errors": ["invalid webhook request: unknown discriminator value: chat_closed"]}`,
+		},
+		"wrong method": {
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+			resp:   `{"errors": ["method not allowed"]}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(method, "/webhook", strings.NewReader(tc.body)))
+
+			require.Equal(t, tc.status, rec.Code)
+			require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			require.JSONEq(t, tc.resp, rec.Body.String())
+		})
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("message without error", func(t *testing.T) {
+		t.Parallel()
+
+		require.Equal(t, "Conflict", (&WebhookError{StatusCode: http.StatusConflict}).Error())
+		require.Equal(t, "webhook error", (&WebhookError{}).Error())
+	})
+
+	t.Run("invalid status code is replaced", func(t *testing.T) {
+		t.Parallel()
+
+		for _, status := range []int{0, 102, 200, 204, 302, 1000} {
+			handler := WebhookHandler(WebhookHandlers{
+				OnMessageRead: func(context.Context, WebhookMessageRead) error {
+					return &WebhookError{StatusCode: status, Err: errors.New("failed")}
+				},
+			})
+
+			rec := httptest.NewRecorder()
+			body := `{"type": "message_read", "meta": {"timestamp": 1}, "data": {"channel_id": 1}}`
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+
+			require.Equal(t, http.StatusInternalServerError, rec.Code, status)
+			require.JSONEq(t, `{"errors": ["failed"]}`, rec.Body.String())
+		}
+	})
+}